@@ -9,4 +9,6 @@ require (
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/stretchr/objx v0.3.0 // indirect
 	github.com/stretchr/testify v1.7.0
+	golang.org/x/crypto v0.10.0
+	golang.org/x/term v0.10.0
 )
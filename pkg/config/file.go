@@ -8,34 +8,127 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/mitchellh/go-homedir"
 )
 
 const (
 	configFileName = "/.kishell"
+	// KibanaServer is a server reached through Kibana. It is the default server type.
+	KibanaServer = "kibana"
+	// ElasticsearchServer is a server reached straight, without Kibana.
+	ElasticsearchServer = "elasticsearch"
+	elasticsearchPort   = "9200"
+	// BasicAuth authenticates with username and password. It is the default authentication type.
+	BasicAuth = "basic"
+	// APIKeyAuth authenticates with an Elasticsearch API key.
+	APIKeyAuth = "apikey"
+	// BearerAuth authenticates with a bearer token, e.g. an OIDC access token.
+	BearerAuth = "bearer"
 )
 
 // Server represents a server definition in the configuration file.
 type Server struct {
+	Type          string `json:"type,omitempty"`
 	Hostname      string `json:"hostname"`
 	Protocol      string `json:"protocol"`
 	Port          string `json:"port"`
 	KibanaVersion string `json:"kibana_version"`
-	BasicAuth     string `json:"basic_auth"`
+	// ElasticsearchVersion is the version elasticsearch servers report, as stored by ping --update-version.
+	ElasticsearchVersion string `json:"elasticsearch_version,omitempty"`
+	AuthType             string `json:"auth_type,omitempty"`
+	BasicAuth            string `json:"basic_auth"`
+	Token                string `json:"token,omitempty"`
+	Secret               string `json:"secret,omitempty"`
+	CAFile               string `json:"ca_file,omitempty"`
+	ClientCert           string `json:"client_cert,omitempty"`
+	ClientKey            string `json:"client_key,omitempty"`
+	// InsecureSkipVerify skips the server certificate verification. Meant for test clusters only.
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty"`
 }
 
-// GetPort gets server port. If not provided it defaults to 443 to https and 80 to http protocols.
+// GetType gets server type. If not provided it defaults to kibana.
+func (s *Server) GetType() string {
+	if len(s.Type) > 0 {
+		return s.Type
+	}
+	return KibanaServer
+}
+
+// GetAuthType gets server authentication type. If not provided it defaults to basic.
+func (s *Server) GetAuthType() string {
+	if len(s.AuthType) > 0 {
+		return s.AuthType
+	}
+	return BasicAuth
+}
+
+// Authorization gets the Authorization header value matching the authentication type. It is empty when the
+// server has no credentials.
+func (s *Server) Authorization() string {
+	switch s.GetAuthType() {
+	case APIKeyAuth:
+		if len(s.Token) > 0 {
+			return "ApiKey " + s.Token
+		}
+	case BearerAuth:
+		if len(s.Token) > 0 {
+			return "Bearer " + s.Token
+		}
+	default:
+		if len(s.BasicAuth) > 0 {
+			return "Basic " + s.BasicAuth
+		}
+	}
+	return ""
+}
+
+// GetPort gets server port. If not provided it defaults to 9200 to elasticsearch servers, otherwise to 443 to https
+// and 80 to http protocols.
 func (s *Server) GetPort() string {
 	if len(s.Port) > 0 {
 		return s.Port
 	}
+	if s.GetType() == ElasticsearchServer {
+		return elasticsearchPort
+	}
 	if s.Protocol == "https" {
 		return "443"
 	}
 	return "80"
 }
 
+// GetVersion gets the version of the server requests are sent to: the Elasticsearch version for elasticsearch
+// servers, the Kibana version otherwise.
+func (s *Server) GetVersion() string {
+	if s.GetType() == ElasticsearchServer {
+		return s.ElasticsearchVersion
+	}
+	return s.KibanaVersion
+}
+
+// VersionAtLeast tells whether the server version is the given major.minor version or a newer one.
+// Versions which can't be parsed are considered older.
+func (s *Server) VersionAtLeast(major int, minor int) bool {
+	parts := strings.SplitN(s.GetVersion(), ".", 3)
+	if len(parts) < 2 {
+		return false
+	}
+	actualMajor, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return false
+	}
+	actualMinor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return false
+	}
+	return actualMajor > major || (actualMajor == major && actualMinor >= minor)
+}
+
 // Role represents a role definition in the configuration file.
 type Role struct {
 	Index        string `json:"index"`
@@ -56,6 +149,11 @@ type ConfigurationFile struct {
 	Roles         map[string]Role   `json:"roles"`
 	CurrentServer string            `json:"default_server"`
 	CurrentRole   string            `json:"default_role"`
+	Secrets       *Secrets          `json:"secrets,omitempty"`
+	// changedServers and changedRoles name the definitions added since the last save, the only ones validated on
+	// save so definitions written by older versions keep loading and saving as they are.
+	changedServers map[string]bool
+	changedRoles   map[string]bool
 }
 
 // Configuration contract to manage the configuration file.
@@ -66,11 +164,20 @@ type Configuration interface {
 	FindServer(name string) (Server, bool)
 	SetServer(name string)
 	AddServer(name string, server Server)
+	RemoveServer(name string)
+	RenameServer(name string, newName string) error
+	ServerNames() []string
 	GetCurrentRole() Role
 	GetRole() string
 	FindRole(name string) (Role, bool)
 	SetRole(name string)
 	AddRole(name string, role Role)
+	RemoveRole(name string)
+	RenameRole(name string, newName string) error
+	RoleNames() []string
+	GetSecrets() Secrets
+	SetSecrets(secrets Secrets)
+	GetSecretBackend(passphrase PassphraseFunc) (SecretBackend, error)
 	PrettyPrint() error
 	Save() error
 	CheckEmpty() error
@@ -118,6 +225,50 @@ func (c *ConfigurationFile) SetServer(name string) {
 // AddServer adds a server definition in the config file.
 func (c *ConfigurationFile) AddServer(name string, server Server) {
 	c.Servers[name] = server
+	if c.changedServers == nil {
+		c.changedServers = map[string]bool{}
+	}
+	c.changedServers[name] = true
+}
+
+// RemoveServer removes a server definition from the config file. The default server is unset when it is removed.
+func (c *ConfigurationFile) RemoveServer(name string) {
+	delete(c.Servers, name)
+	delete(c.changedServers, name)
+	if c.CurrentServer == name {
+		c.CurrentServer = ""
+	}
+}
+
+// RenameServer renames a server definition, keeping it as default server if it was.
+func (c *ConfigurationFile) RenameServer(name string, newName string) error {
+	server, ok := c.Servers[name]
+	if !ok {
+		return fmt.Errorf("server '%s' is not a valid option", name)
+	}
+	if _, ok := c.Servers[newName]; ok {
+		return fmt.Errorf("server '%s' already exists", newName)
+	}
+	delete(c.Servers, name)
+	c.Servers[newName] = server
+	if c.changedServers[name] {
+		delete(c.changedServers, name)
+		c.changedServers[newName] = true
+	}
+	if c.CurrentServer == name {
+		c.CurrentServer = newName
+	}
+	return nil
+}
+
+// ServerNames gets the server names sorted.
+func (c *ConfigurationFile) ServerNames() []string {
+	names := make([]string, 0, len(c.Servers))
+	for name := range c.Servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 // GetCurrentRole gets the current role definition.
@@ -144,6 +295,80 @@ func (c *ConfigurationFile) SetRole(name string) {
 // AddRole adds role in the config file.
 func (c *ConfigurationFile) AddRole(name string, role Role) {
 	c.Roles[name] = role
+	if c.changedRoles == nil {
+		c.changedRoles = map[string]bool{}
+	}
+	c.changedRoles[name] = true
+}
+
+// GetSecrets gets the secret backend settings.
+func (c *ConfigurationFile) GetSecrets() Secrets {
+	if c.Secrets == nil {
+		return Secrets{}
+	}
+	return *c.Secrets
+}
+
+// SetSecrets sets the secret backend settings.
+func (c *ConfigurationFile) SetSecrets(secrets Secrets) {
+	c.Secrets = &secrets
+}
+
+// GetSecretBackend gets the secret backend servers reference their credentials from. The vault file is kept next to
+// the config file unless another one is given.
+func (c *ConfigurationFile) GetSecretBackend(passphrase PassphraseFunc) (SecretBackend, error) {
+	secrets := c.GetSecrets()
+	switch secrets.GetBackend() {
+	case VaultSecrets:
+		file := secrets.VaultFile
+		if len(file) <= 0 {
+			file = c.location.path + vaultFileName
+		}
+		return NewVault(file, passphrase), nil
+	case ExecSecrets:
+		return &ExecHelper{Command: secrets.Command}, nil
+	}
+	return nil, fmt.Errorf("secret backend '%s' is invalid", secrets.Backend)
+}
+
+// RemoveRole removes a role definition from the config file. The default role is unset when it is removed.
+func (c *ConfigurationFile) RemoveRole(name string) {
+	delete(c.Roles, name)
+	delete(c.changedRoles, name)
+	if c.CurrentRole == name {
+		c.CurrentRole = ""
+	}
+}
+
+// RenameRole renames a role definition, keeping it as default role if it was.
+func (c *ConfigurationFile) RenameRole(name string, newName string) error {
+	role, ok := c.Roles[name]
+	if !ok {
+		return fmt.Errorf("role '%s' is not a valid option", name)
+	}
+	if _, ok := c.Roles[newName]; ok {
+		return fmt.Errorf("role '%s' already exists", newName)
+	}
+	delete(c.Roles, name)
+	c.Roles[newName] = role
+	if c.changedRoles[name] {
+		delete(c.changedRoles, name)
+		c.changedRoles[newName] = true
+	}
+	if c.CurrentRole == name {
+		c.CurrentRole = newName
+	}
+	return nil
+}
+
+// RoleNames gets the role names sorted.
+func (c *ConfigurationFile) RoleNames() []string {
+	names := make([]string, 0, len(c.Roles))
+	for name := range c.Roles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 // PrettyPrint prints the config file contents prettier.
@@ -161,8 +386,12 @@ func (c *ConfigurationFile) PrettyPrint() error {
 	return nil
 }
 
-// Save saves the config file in the files system in a JSON format.
+// Save saves the config file in the files system in a JSON format. Invalid server and role definitions added since
+// the last save are refused.
 func (c *ConfigurationFile) Save() error {
+	if err := c.validateChanged(); err != nil {
+		return err
+	}
 	content, err := json.Marshal(c)
 	if err != nil {
 		return err
@@ -171,6 +400,8 @@ func (c *ConfigurationFile) Save() error {
 	if err != nil {
 		return err
 	}
+	c.changedServers = nil
+	c.changedRoles = nil
 	return nil
 }
 
@@ -188,6 +419,7 @@ func (c *ConfigurationFile) Reset() error {
 	c.Roles = make(map[string]Role)
 	c.CurrentServer = ""
 	c.CurrentRole = ""
+	c.Secrets = nil
 	return c.Save()
 }
 
@@ -202,11 +434,19 @@ func homeDir() string {
 	return homeDir
 }
 
-// LoadDefaultConfig loads configuration from the default file config.
+// LoadDefaultConfig loads configuration from the default file config, unless KISHELL_CONFIG gives another file.
 func LoadDefaultConfig() Configuration {
+	if file := os.Getenv(ConfigEnv); len(file) > 0 {
+		return LoadConfig(file)
+	}
 	return loadConfig(homeDir(), configFileName)
 }
 
+// LoadConfig loads configuration from the file given.
+func LoadConfig(file string) Configuration {
+	return loadConfig(filepath.Dir(file), string(filepath.Separator)+filepath.Base(file))
+}
+
 func loadConfig(path string, fileName string) Configuration {
 	jsonFile, err := os.Open(path + fileName)
 	if err != nil && os.IsNotExist(err) {
@@ -2,6 +2,7 @@ package config
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"testing"
@@ -42,6 +43,16 @@ func TestLoadConfigFile(t *testing.T) {
 	if server.GetPort() != "443" {
 		t.Errorf("Invalid server port %s", server.GetPort())
 	}
+	if server.GetType() != KibanaServer {
+		t.Errorf("Invalid server type %s", server.GetType())
+	}
+	server, _ = file.FindServer("esServer")
+	if server.GetPort() != "9200" {
+		t.Errorf("Invalid server port %s", server.GetPort())
+	}
+	if server.GetType() != ElasticsearchServer {
+		t.Errorf("Invalid server type %s", server.GetType())
+	}
 }
 
 func TestResetConfigFile(t *testing.T) {
@@ -121,3 +132,91 @@ func createTempConfig() (*ConfigurationFile, error) {
 	}
 	return &file, nil
 }
+
+func TestVersionAtLeast(t *testing.T) {
+	tests := []struct {
+		version  string
+		expected bool
+	}{
+		{"7.10.0", true},
+		{"7.10", true},
+		{"7.17.3", true},
+		{"8.0.0", true},
+		{"7.9.3", false},
+		{"6.8.6", false},
+		{"", false},
+		{"latest", false},
+	}
+	for _, test := range tests {
+		server := Server{KibanaVersion: test.version}
+		if server.VersionAtLeast(7, 10) != test.expected {
+			t.Errorf("Expected %s to be at least 7.10: %t", test.version, test.expected)
+		}
+	}
+}
+
+func TestVersionAtLeastElasticsearch(t *testing.T) {
+	server := Server{Type: ElasticsearchServer, KibanaVersion: "7.10.2", ElasticsearchVersion: "6.8.6"}
+	if server.VersionAtLeast(7, 10) {
+		t.Error("Elasticsearch servers must be compared by their Elasticsearch version")
+	}
+	server.ElasticsearchVersion = "8.11.0"
+	if !server.VersionAtLeast(8, 0) {
+		t.Error("Expected 8.11.0 to be at least 8.0")
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+	tests := []struct {
+		server   Server
+		expected string
+	}{
+		{Server{BasicAuth: "dXNlcjpwYXNz"}, "Basic dXNlcjpwYXNz"},
+		{Server{AuthType: BasicAuth, BasicAuth: "dXNlcjpwYXNz"}, "Basic dXNlcjpwYXNz"},
+		{Server{AuthType: APIKeyAuth, Token: "aWQ6a2V5"}, "ApiKey aWQ6a2V5"},
+		{Server{AuthType: BearerAuth, Token: "eyJhbGciOi"}, "Bearer eyJhbGciOi"},
+		{Server{AuthType: BearerAuth, BasicAuth: "dXNlcjpwYXNz"}, ""},
+		{Server{}, ""},
+	}
+	for _, test := range tests {
+		if authorization := test.server.Authorization(); authorization != test.expected {
+			t.Errorf("Expected authorization %q, got %q", test.expected, authorization)
+		}
+	}
+}
+
+func TestRemoveRenameServerNRole(t *testing.T) {
+	file := loadConfig(testConfigPath, testConfigFile).(*ConfigurationFile)
+
+	if err := file.RenameServer("local", "renamed"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := file.FindServer("renamed"); !ok || file.GetServer() != "renamed" {
+		t.Errorf("Renamed default server must stay default, got %s", file.GetServer())
+	}
+	if err := file.RenameServer("renamed", "httpServer"); err == nil {
+		t.Error("Renaming onto an existing server must fail")
+	}
+	if err := file.RenameServer("missing", "other"); err == nil {
+		t.Error("Renaming a missing server must fail")
+	}
+	file.RemoveServer("renamed")
+	if _, ok := file.FindServer("renamed"); ok || file.GetServer() != "" {
+		t.Error("Removed default server must be unset")
+	}
+	expected := []string{"esServer", "httpServer", "httpsServer"}
+	if names := file.ServerNames(); fmt.Sprint(names) != fmt.Sprint(expected) {
+		t.Errorf("Expected servers %v but was %v", expected, names)
+	}
+
+	if err := file.RenameRole("local", "renamed"); err != nil {
+		t.Fatal(err)
+	}
+	if file.GetRole() != "renamed" {
+		t.Errorf("Renamed default role must stay default, got %s", file.GetRole())
+	}
+	file.RemoveRole("renamed")
+	if len(file.RoleNames()) != len(file.Roles) || file.GetRole() != "" {
+		t.Error("Removed default role must be unset")
+	}
+}
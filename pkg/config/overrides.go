@@ -0,0 +1,245 @@
+package config
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const (
+	// ConfigEnv is the environment variable holding the config file path, overriding ~/.kishell.
+	ConfigEnv = "KISHELL_CONFIG"
+	// ServerURLEnv is the environment variable holding the server URL, e.g. https://kibana.example.com:5601.
+	ServerURLEnv = "KISHELL_SERVER_URL"
+	// ServerTypeEnv is the environment variable holding the server type, either kibana or elasticsearch.
+	ServerTypeEnv = "KISHELL_SERVER_TYPE"
+	// KibanaVersionEnv is the environment variable holding the Kibana version.
+	KibanaVersionEnv = "KISHELL_KIBANA_VERSION"
+	// ElasticsearchVersionEnv is the environment variable holding the Elasticsearch version.
+	ElasticsearchVersionEnv = "KISHELL_ES_VERSION"
+	// UsernameEnv is the environment variable holding the username for basic authentication.
+	UsernameEnv = "KISHELL_USERNAME"
+	// PasswordEnv is the environment variable holding the password for basic authentication.
+	PasswordEnv = "KISHELL_PASSWORD"
+	// IndexEnv is the environment variable holding the index pattern to search.
+	IndexEnv = "KISHELL_INDEX"
+	// WindowFilterEnv is the environment variable holding the field the time window is filtered by.
+	WindowFilterEnv = "KISHELL_WINDOW_FILTER"
+	maskedPassword  = "********"
+	// defaultWindowFilter is the field the time window is filtered by when neither the role nor the overrides
+	// give one.
+	defaultWindowFilter = "@timestamp"
+)
+
+// Overrides represents server and role fields given outside of the configuration file, through environment variables
+// or flags. Empty fields leave the configuration file values as they are.
+type Overrides struct {
+	ServerURL            string `json:"server_url,omitempty"`
+	ServerType           string `json:"server_type,omitempty"`
+	KibanaVersion        string `json:"kibana_version,omitempty"`
+	ElasticsearchVersion string `json:"elasticsearch_version,omitempty"`
+	Username             string `json:"username,omitempty"`
+	Password             string `json:"password,omitempty"`
+	Index                string `json:"index,omitempty"`
+	WindowFilter         string `json:"window_filter,omitempty"`
+}
+
+// EnvOverrides gets the overrides given through KISHELL_* environment variables.
+func EnvOverrides() Overrides {
+	return Overrides{
+		ServerURL:            os.Getenv(ServerURLEnv),
+		ServerType:           os.Getenv(ServerTypeEnv),
+		KibanaVersion:        os.Getenv(KibanaVersionEnv),
+		ElasticsearchVersion: os.Getenv(ElasticsearchVersionEnv),
+		Username:             os.Getenv(UsernameEnv),
+		Password:             os.Getenv(PasswordEnv),
+		Index:                os.Getenv(IndexEnv),
+		WindowFilter:         os.Getenv(WindowFilterEnv),
+	}
+}
+
+// Merge gives the overrides with the fields set in other taking precedence.
+func (o Overrides) Merge(other Overrides) Overrides {
+	pick := func(value string, otherValue string) string {
+		if len(otherValue) > 0 {
+			return otherValue
+		}
+		return value
+	}
+	return Overrides{
+		ServerURL:            pick(o.ServerURL, other.ServerURL),
+		ServerType:           pick(o.ServerType, other.ServerType),
+		KibanaVersion:        pick(o.KibanaVersion, other.KibanaVersion),
+		ElasticsearchVersion: pick(o.ElasticsearchVersion, other.ElasticsearchVersion),
+		Username:             pick(o.Username, other.Username),
+		Password:             pick(o.Password, other.Password),
+		Index:                pick(o.Index, other.Index),
+		WindowFilter:         pick(o.WindowFilter, other.WindowFilter),
+	}
+}
+
+// IsEmpty tells whether no field is overridden.
+func (o Overrides) IsEmpty() bool {
+	return o == Overrides{}
+}
+
+// overriddenConfiguration layers the overrides on top of the configuration file. The servers and roles it gives are
+// ephemeral: they are never written back to the configuration file.
+type overriddenConfiguration struct {
+	Configuration
+	overrides Overrides
+	endpoint  *url.URL
+}
+
+// WithOverrides layers the overrides on top of the configuration.
+func WithOverrides(configuration Configuration, overrides Overrides) (Configuration, error) {
+	if overrides.IsEmpty() {
+		return configuration, nil
+	}
+	overridden := &overriddenConfiguration{
+		Configuration: configuration,
+		overrides:     overrides,
+	}
+	if len(overrides.ServerURL) > 0 {
+		endpoint, err := ParseServerURL(overrides.ServerURL)
+		if err != nil {
+			return nil, err
+		}
+		overridden.endpoint = endpoint
+	}
+	return overridden, nil
+}
+
+// Stored gives the configuration without the overrides layered on top, so definitions read out of it can be written
+// back to the configuration file.
+func Stored(configuration Configuration) Configuration {
+	if overridden, ok := configuration.(*overriddenConfiguration); ok {
+		return overridden.Configuration
+	}
+	return configuration
+}
+
+// OverridesRole tells whether the overrides replace the index or window filter of every role the configuration gives.
+func OverridesRole(configuration Configuration) bool {
+	overridden, ok := configuration.(*overriddenConfiguration)
+	return ok && (len(overridden.overrides.Index) > 0 || len(overridden.overrides.WindowFilter) > 0)
+}
+
+// ParseServerURL parses a server URL, which must hold a http or https scheme and a hostname.
+func ParseServerURL(serverURL string) (*url.URL, error) {
+	endpoint, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, fmt.Errorf("server URL '%s' is invalid: %s", serverURL, err)
+	}
+	if (endpoint.Scheme != "http" && endpoint.Scheme != "https") || len(endpoint.Hostname()) <= 0 {
+		return nil, fmt.Errorf("server URL '%s' is invalid. Expected e.g. https://kibana.example.com:5601",
+			serverURL)
+	}
+	return endpoint, nil
+}
+
+// GetCurrentServer gets the current server definition with the overrides applied.
+func (c *overriddenConfiguration) GetCurrentServer() Server {
+	return c.server(c.Configuration.GetCurrentServer())
+}
+
+// FindServer finds a server by name with the overrides applied.
+func (c *overriddenConfiguration) FindServer(name string) (Server, bool) {
+	server, ok := c.Configuration.FindServer(name)
+	return c.server(server), ok
+}
+
+// GetCurrentRole gets the current role definition with the overrides applied.
+func (c *overriddenConfiguration) GetCurrentRole() Role {
+	return c.role(c.Configuration.GetCurrentRole())
+}
+
+// FindRole finds a role by name with the overrides applied.
+func (c *overriddenConfiguration) FindRole(name string) (Role, bool) {
+	role, ok := c.Configuration.FindRole(name)
+	return c.role(role), ok
+}
+
+// CheckEmpty checks if the overrides together with the configuration file define both a server and a role.
+func (c *overriddenConfiguration) CheckEmpty() error {
+	if len(c.GetCurrentServer().Hostname) <= 0 || len(c.GetCurrentRole().Index) <= 0 {
+		return errors.New("kishell is not configured. Use configure option or set KISHELL_SERVER_URL and " +
+			"KISHELL_INDEX before searching")
+	}
+	return nil
+}
+
+// PrettyPrint prints the config file contents followed by the overrides. The password is masked.
+func (c *overriddenConfiguration) PrettyPrint() error {
+	if err := c.Configuration.PrettyPrint(); err != nil {
+		return err
+	}
+	overrides := c.overrides
+	if len(overrides.Password) > 0 {
+		overrides.Password = maskedPassword
+	}
+	content, err := json.MarshalIndent(map[string]Overrides{"overrides": overrides}, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(content))
+	return nil
+}
+
+// server applies the overrides to the server. Overriding the URL points the server to another host, so the stored
+// credentials and TLS settings are dropped rather than sent there: only the overridden credentials are kept.
+func (c *overriddenConfiguration) server(server Server) Server {
+	if c.endpoint != nil {
+		server = Server{
+			Type:                 server.Type,
+			Protocol:             c.endpoint.Scheme,
+			Hostname:             c.endpoint.Hostname(),
+			Port:                 c.endpoint.Port(),
+			KibanaVersion:        server.KibanaVersion,
+			ElasticsearchVersion: server.ElasticsearchVersion,
+		}
+	}
+	if len(c.overrides.ServerType) > 0 {
+		server.Type = c.overrides.ServerType
+	}
+	if len(c.overrides.KibanaVersion) > 0 {
+		server.KibanaVersion = c.overrides.KibanaVersion
+	}
+	if len(c.overrides.ElasticsearchVersion) > 0 {
+		server.ElasticsearchVersion = c.overrides.ElasticsearchVersion
+	}
+	if len(c.overrides.Username) > 0 || len(c.overrides.Password) > 0 {
+		username, password := c.overrides.Username, c.overrides.Password
+		if current, err := base64.StdEncoding.DecodeString(server.BasicAuth); err == nil && len(current) > 0 {
+			parts := strings.SplitN(string(current), ":", 2)
+			if len(username) <= 0 {
+				username = parts[0]
+			}
+			if len(password) <= 0 && len(parts) > 1 {
+				password = parts[1]
+			}
+		}
+		server.AuthType = BasicAuth
+		server.BasicAuth = base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+		server.Token = ""
+		server.Secret = ""
+	}
+	return server
+}
+
+func (c *overriddenConfiguration) role(role Role) Role {
+	if len(c.overrides.Index) > 0 {
+		role.Index = c.overrides.Index
+	}
+	if len(c.overrides.WindowFilter) > 0 {
+		role.WindowFilter = c.overrides.WindowFilter
+	}
+	if len(role.Index) > 0 && len(role.WindowFilter) <= 0 {
+		role.WindowFilter = defaultWindowFilter
+	}
+	return role
+}
@@ -0,0 +1,183 @@
+package config
+
+import (
+	"encoding/base64"
+	"os"
+	"testing"
+)
+
+func TestOverridesMerge(t *testing.T) {
+	env := Overrides{ServerURL: "http://env.test", Index: "env-*", Username: "env-user"}
+	flags := Overrides{Index: "flag-*"}
+	merged := env.Merge(flags)
+	expected := Overrides{ServerURL: "http://env.test", Index: "flag-*", Username: "env-user"}
+	if merged != expected {
+		t.Errorf("Expected %+v but was %+v", expected, merged)
+	}
+}
+
+func TestEnvOverrides(t *testing.T) {
+	os.Setenv(ServerURLEnv, "https://env.test:9243")
+	os.Setenv(IndexEnv, "env-*")
+	defer os.Unsetenv(ServerURLEnv)
+	defer os.Unsetenv(IndexEnv)
+
+	expected := Overrides{ServerURL: "https://env.test:9243", Index: "env-*"}
+	if overrides := EnvOverrides(); overrides != expected {
+		t.Errorf("Expected %+v but was %+v", expected, overrides)
+	}
+}
+
+func TestEphemeralServerAndRole(t *testing.T) {
+	file := loadConfig(testConfigPath, "/file-does-not-exist.json")
+	configuration, err := WithOverrides(file, Overrides{
+		ServerURL:            "https://ci.test:9243",
+		ServerType:           ElasticsearchServer,
+		ElasticsearchVersion: "8.11.1",
+		Username:             "ci",
+		Password:             "secret",
+		Index:                "ci-*",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := configuration.CheckEmpty(); err != nil {
+		t.Fatal("Overrides must be enough to search without configuring", err)
+	}
+	server := configuration.GetCurrentServer()
+	expected := Server{
+		Type:                 ElasticsearchServer,
+		Protocol:             "https",
+		Hostname:             "ci.test",
+		Port:                 "9243",
+		ElasticsearchVersion: "8.11.1",
+		AuthType:             BasicAuth,
+		BasicAuth:            base64.StdEncoding.EncodeToString([]byte("ci:secret")),
+	}
+	if server != expected {
+		t.Errorf("Expected server %+v but was %+v", expected, server)
+	}
+	role := configuration.GetCurrentRole()
+	if role.Index != "ci-*" || role.WindowFilter != "@timestamp" {
+		t.Errorf("Unexpected role %+v", role)
+	}
+	if len(file.(*ConfigurationFile).Servers) > 0 {
+		t.Error("Ephemeral server must not be added to the configuration file")
+	}
+}
+
+func TestOverridesOnTopOfConfigFile(t *testing.T) {
+	file := loadConfig(testConfigPath, testConfigFile)
+	configuration, err := WithOverrides(file, Overrides{Password: "overridden", WindowFilter: "event.created"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := configuration.GetCurrentServer()
+	if server.Hostname != "local.test.net" || server.Port != "8080" {
+		t.Errorf("Server fields not overridden must be kept, got %+v", server)
+	}
+	credentials, _ := base64.StdEncoding.DecodeString(server.BasicAuth)
+	if string(credentials) != "test:overridden" {
+		t.Errorf("Username must be kept while password is overridden, got %s", credentials)
+	}
+	httpsServer, ok := configuration.FindServer("httpsServer")
+	if !ok || httpsServer.Protocol != "https" {
+		t.Errorf("Unexpected server %+v", httpsServer)
+	}
+	role := configuration.GetCurrentRole()
+	if role.Index != file.GetCurrentRole().Index || role.WindowFilter != "event.created" {
+		t.Errorf("Unexpected role %+v", role)
+	}
+}
+
+func TestServerURLDropsStoredCredentials(t *testing.T) {
+	file := loadConfig(testConfigPath, testConfigFile)
+	file.AddServer("secured", Server{
+		Protocol:   "https",
+		Hostname:   "kibana.test",
+		BasicAuth:  "dGVzdDpzZWNyZXQ=",
+		Secret:     "prod",
+		ClientCert: "client.pem",
+		ClientKey:  "client-key.pem",
+	})
+	configuration, err := WithOverrides(file, Overrides{ServerURL: "https://other.test:9243"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, _ := configuration.FindServer("secured")
+	if server.Hostname != "other.test" || len(server.Authorization()) > 0 || len(server.Secret) > 0 ||
+		len(server.ClientCert) > 0 {
+		t.Errorf("Stored credentials must not be sent to the overridden URL, got %+v", server)
+	}
+
+	configuration, err = WithOverrides(file, Overrides{ServerURL: "https://other.test:9243", Username: "ci"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, _ = configuration.FindServer("secured")
+	credentials, _ := base64.StdEncoding.DecodeString(server.BasicAuth)
+	if string(credentials) != "ci:" {
+		t.Errorf("Only the overridden credentials must be sent to the overridden URL, got %s", credentials)
+	}
+}
+
+func TestInvalidServerURL(t *testing.T) {
+	file := loadConfig(testConfigPath, testConfigFile)
+	for _, serverURL := range []string{"ci.test:9243", "ftp://ci.test", "https://", "http://%zz"} {
+		if _, err := WithOverrides(file, Overrides{ServerURL: serverURL}); err == nil {
+			t.Errorf("Expected server URL %s to be invalid", serverURL)
+		}
+	}
+}
+
+func TestNoOverrides(t *testing.T) {
+	file := loadConfig(testConfigPath, testConfigFile)
+	configuration, err := WithOverrides(file, Overrides{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configuration != file {
+		t.Error("Configuration must be left as is without overrides")
+	}
+}
+
+func TestStoredWithoutOverrides(t *testing.T) {
+	file := loadConfig(testConfigPath, testConfigFile)
+	configuration, err := WithOverrides(file, Overrides{KibanaVersion: "8.0.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Stored(configuration) != file || Stored(file) != file {
+		t.Error("Stored configuration must be the config file without the overrides")
+	}
+}
+
+func TestOverridesRole(t *testing.T) {
+	file := loadConfig(testConfigPath, testConfigFile)
+	for overrides, expected := range map[Overrides]bool{
+		{Index: "audit-*"}:              true,
+		{WindowFilter: "event.created"}: true,
+		{KibanaVersion: "8.0.0"}:        false,
+	} {
+		configuration, err := WithOverrides(file, overrides)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if OverridesRole(configuration) != expected {
+			t.Errorf("Expected %v for %+v", expected, overrides)
+		}
+	}
+	if OverridesRole(file) {
+		t.Error("Config file alone must not override roles")
+	}
+}
+
+func TestLoadConfigFromEnv(t *testing.T) {
+	os.Setenv(ConfigEnv, testConfigPath+testConfigFile)
+	defer os.Unsetenv(ConfigEnv)
+
+	configuration := LoadDefaultConfig()
+	if configuration.GetServer() != "local" {
+		t.Errorf("Config file must be loaded from %s, got %+v", ConfigEnv, configuration)
+	}
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"unicode"
+)
+
+const (
+	// VaultSecrets keeps secrets in a passphrase encrypted file. It is the default secret backend.
+	VaultSecrets = "vault"
+	// ExecSecrets fetches secrets running a helper command, e.g. a password manager CLI.
+	ExecSecrets   = "exec"
+	vaultFileName = "/.kishell-vault"
+)
+
+// ErrReadOnlySecrets is returned when storing a secret in a backend which can only fetch them.
+var ErrReadOnlySecrets = errors.New("secret backend is read-only")
+
+// A SecretBackend represents a contract to fetch and store secrets by name.
+type SecretBackend interface {
+	// Get fetches the secret value by name.
+	Get(name string) (string, error)
+	// Set stores the secret value by name. Backends which can't store secrets give ErrReadOnlySecrets.
+	Set(name string, value string) error
+	// Writable tells whether the backend can store secrets.
+	Writable() bool
+}
+
+// Secrets represents the secret backend settings in the configuration file.
+type Secrets struct {
+	Backend   string `json:"backend,omitempty"`
+	Command   string `json:"command,omitempty"`
+	VaultFile string `json:"vault_file,omitempty"`
+}
+
+// GetBackend gets the secret backend name. If not provided it defaults to vault.
+func (s *Secrets) GetBackend() string {
+	if len(s.Backend) > 0 {
+		return s.Backend
+	}
+	return VaultSecrets
+}
+
+// ExecHelper fetches secrets out of the standard output of a command, which is given the secret name as its last
+// argument, e.g. "secret-tool lookup kishell" runs "secret-tool lookup kishell <name>".
+type ExecHelper struct {
+	Command string
+}
+
+// Get runs the command and gives its output without the trailing line break.
+func (e *ExecHelper) Get(name string) (string, error) {
+	args, err := splitCommand(e.Command)
+	if err != nil {
+		return "", err
+	}
+	if len(args) <= 0 {
+		return "", errors.New("secret helper command is missing")
+	}
+	var stdout bytes.Buffer
+	command := exec.Command(args[0], append(args[1:], name)...)
+	command.Stdout = &stdout
+	command.Stderr = os.Stderr
+	if err := command.Run(); err != nil {
+		return "", fmt.Errorf("secret helper failed to fetch '%s': %s", name, err)
+	}
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
+
+// splitCommand splits the command into arguments the way a shell would, without expanding anything: arguments are
+// separated by spaces unless quoted, single quotes keep every character as is, and backslashes escape the next
+// character outside of them.
+func splitCommand(command string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, c := range command {
+		switch {
+		case escaped:
+			arg.WriteRune(c)
+			escaped = false
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				arg.WriteRune(c)
+			}
+		case c == '\\':
+			escaped = true
+			inArg = true
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else {
+				arg.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case unicode.IsSpace(c):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("secret helper command '%s' has an unterminated quote or escape", command)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// Set can't store secrets, they are managed by the helper itself.
+func (e *ExecHelper) Set(name string, value string) error {
+	return ErrReadOnlySecrets
+}
+
+// Writable is always false, secrets are managed by the helper itself.
+func (e *ExecHelper) Writable() bool {
+	return false
+}
+
+// ResolveSecret fills the server credentials in out of the secret it references. The secret holds what would be
+// stored in the configuration file otherwise: the base64 encoded username and password for basic authentication, or
+// the token for the others.
+func ResolveSecret(server Server, backend SecretBackend) (Server, error) {
+	if len(server.Secret) <= 0 {
+		return server, nil
+	}
+	value, err := backend.Get(server.Secret)
+	if err != nil {
+		return Server{}, err
+	}
+	if server.GetAuthType() == BasicAuth {
+		server.BasicAuth = value
+	} else {
+		server.Token = value
+	}
+	return server, nil
+}
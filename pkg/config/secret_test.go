@@ -0,0 +1,93 @@
+package config
+
+import (
+	"testing"
+)
+
+type staticSecrets map[string]string
+
+func (s staticSecrets) Get(name string) (string, error) {
+	return s[name], nil
+}
+
+func (s staticSecrets) Set(name string, value string) error {
+	return ErrReadOnlySecrets
+}
+
+func (s staticSecrets) Writable() bool {
+	return false
+}
+
+func TestResolveSecret(t *testing.T) {
+	backend := staticSecrets{"basic": "dGVzdDpwYXNzd2Q=", "token": "eyJhbGciOi"}
+	tests := []struct {
+		server   Server
+		expected string
+	}{
+		{Server{Secret: "basic"}, "Basic dGVzdDpwYXNzd2Q="},
+		{Server{AuthType: BearerAuth, Secret: "token"}, "Bearer eyJhbGciOi"},
+		{Server{BasicAuth: "aW5saW5l"}, "Basic aW5saW5l"},
+	}
+	for _, test := range tests {
+		server, err := ResolveSecret(test.server, backend)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if authorization := server.Authorization(); authorization != test.expected {
+			t.Errorf("Expected authorization %q, got %q", test.expected, authorization)
+		}
+	}
+}
+
+func TestExecHelper(t *testing.T) {
+	helper := ExecHelper{Command: "echo secret-of"}
+	value, err := helper.Get("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "secret-of prod" {
+		t.Errorf("Unexpected secret value %q", value)
+	}
+	if helper.Set("prod", "value") != ErrReadOnlySecrets {
+		t.Error("Exec helper must be read-only")
+	}
+	if _, err := (&ExecHelper{Command: "false"}).Get("prod"); err == nil {
+		t.Error("Failing helper must be reported")
+	}
+}
+
+func TestExecHelperQuotedArgs(t *testing.T) {
+	helper := ExecHelper{Command: `printf '%s|%s|%s' "two words" it\'s`}
+	value, err := helper.Get("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "two words|it's|prod" {
+		t.Errorf("Quoted arguments must be kept whole, got %q", value)
+	}
+	if _, err := (&ExecHelper{Command: `echo "unterminated`}).Get("prod"); err == nil {
+		t.Error("Unterminated quotes must be reported")
+	}
+}
+
+func TestGetSecretBackend(t *testing.T) {
+	file := loadConfig(testConfigPath, testConfigFile)
+	backend, err := file.GetSecretBackend(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vault, ok := backend.(*Vault)
+	if !ok || vault.file != testConfigPath+vaultFileName {
+		t.Errorf("Expected the default vault next to the config file, got %+v", backend)
+	}
+
+	file.SetSecrets(Secrets{Backend: ExecSecrets, Command: "pass show"})
+	if backend, _ := file.GetSecretBackend(nil); backend.Writable() {
+		t.Error("Expected the exec helper backend")
+	}
+
+	file.SetSecrets(Secrets{Backend: "keyring"})
+	if _, err := file.GetSecretBackend(nil); err == nil {
+		t.Error("Unknown secret backend must be reported")
+	}
+}
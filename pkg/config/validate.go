@@ -0,0 +1,203 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxIndexNameLength = 255
+	illegalIndexChars  = `\/?"<>| #`
+)
+
+// semverPattern matches semantic versions, e.g. 7.10.2 or 8.0.0-rc1, as defined by https://semver.org.
+var semverPattern = regexp.MustCompile(`^(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)` +
+	`(-[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?(\+[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?$`)
+
+// Validate checks the server definition, giving the first invalid field found.
+func (s *Server) Validate() error {
+	if err := ValidateServerType(s.Type); err != nil {
+		return err
+	}
+	if err := ValidateProtocol(s.Protocol); err != nil {
+		return err
+	}
+	if err := ValidateHostname(s.Hostname); err != nil {
+		return err
+	}
+	if err := ValidatePort(s.Port); err != nil {
+		return err
+	}
+	if err := ValidateAuthType(s.AuthType); err != nil {
+		return err
+	}
+	if s.GetType() == KibanaServer || len(s.KibanaVersion) > 0 {
+		if err := ValidateKibanaVersion(s.KibanaVersion); err != nil {
+			return err
+		}
+	}
+	if len(s.ElasticsearchVersion) > 0 {
+		if err := ValidateElasticsearchVersion(s.ElasticsearchVersion); err != nil {
+			return err
+		}
+	}
+	if (len(s.ClientCert) > 0) != (len(s.ClientKey) > 0) {
+		return errors.New("client certificate and client key must be given together")
+	}
+	return nil
+}
+
+// Validate checks the role definition, giving the first invalid field found.
+func (r *Role) Validate() error {
+	if err := ValidateIndexPattern(r.Index); err != nil {
+		return err
+	}
+	return ValidateWindowFilter(r.WindowFilter)
+}
+
+// ValidateServerType checks the server type is either kibana or elasticsearch. Empty defaults to kibana.
+func ValidateServerType(serverType string) error {
+	if len(serverType) > 0 && serverType != KibanaServer && serverType != ElasticsearchServer {
+		return fmt.Errorf("server type '%s' is invalid. Expected kibana or elasticsearch", serverType)
+	}
+	return nil
+}
+
+// ValidateProtocol checks the protocol is either http or https.
+func ValidateProtocol(protocol string) error {
+	if protocol != "http" && protocol != "https" {
+		return fmt.Errorf("protocol '%s' is invalid. Expected http or https", protocol)
+	}
+	return nil
+}
+
+// ValidateHostname checks the hostname is given and holds neither a scheme, a port nor a path.
+func ValidateHostname(hostname string) error {
+	if len(hostname) <= 0 {
+		return errors.New("hostname is missing")
+	}
+	if strings.ContainsAny(hostname, ":/ ") {
+		return fmt.Errorf("hostname '%s' is invalid. Expected a hostname only, e.g. kibana.example.com", hostname)
+	}
+	return nil
+}
+
+// ValidatePort checks the port is a number from 1 to 65535. Empty defaults to the protocol or server type port.
+func ValidatePort(port string) error {
+	if len(port) <= 0 {
+		return nil
+	}
+	number, err := strconv.Atoi(port)
+	if err != nil || number < 1 || number > 65535 {
+		return fmt.Errorf("port '%s' is invalid. Expected a number from 1 to 65535", port)
+	}
+	return nil
+}
+
+// ValidateAuthType checks the authentication type is either basic, apikey or bearer. Empty defaults to basic.
+func ValidateAuthType(authType string) error {
+	if len(authType) > 0 && authType != BasicAuth && authType != APIKeyAuth && authType != BearerAuth {
+		return fmt.Errorf("authentication type '%s' is invalid. Expected basic, apikey or bearer", authType)
+	}
+	return nil
+}
+
+// ValidateKibanaVersion checks the Kibana version is a semantic version, e.g. 7.10.2.
+func ValidateKibanaVersion(version string) error {
+	if !semverPattern.MatchString(version) {
+		return fmt.Errorf("Kibana version '%s' is invalid. Expected a version like 7.10.2", version)
+	}
+	return nil
+}
+
+// ValidateElasticsearchVersion checks the Elasticsearch version is a semantic version, e.g. 8.11.1.
+func ValidateElasticsearchVersion(version string) error {
+	if !semverPattern.MatchString(version) {
+		return fmt.Errorf("Elasticsearch version '%s' is invalid. Expected a version like 8.11.1", version)
+	}
+	return nil
+}
+
+// ValidateIndexPattern checks the index pattern follows the Elasticsearch index naming rules. It may list several
+// comma separated indices, aliases or wildcard expressions, excluding some with a leading dash, and prefix them with
+// a remote cluster name, e.g. "logs-*,-logs-old" or "eu:logs-*".
+func ValidateIndexPattern(pattern string) error {
+	if len(pattern) <= 0 {
+		return errors.New("index pattern is missing")
+	}
+	for i, index := range strings.Split(pattern, ",") {
+		if i > 0 {
+			index = strings.TrimPrefix(index, "-")
+		}
+		if colon := strings.LastIndex(index, ":"); colon >= 0 {
+			index = index[colon+1:]
+		}
+		if err := validateIndexName(index); err != nil {
+			return fmt.Errorf("index pattern '%s' is invalid: %s", pattern, err)
+		}
+	}
+	return nil
+}
+
+func validateIndexName(index string) error {
+	switch {
+	case len(index) <= 0:
+		return errors.New("index name is empty")
+	case len(index) > maxIndexNameLength:
+		return fmt.Errorf("index name is longer than %d bytes", maxIndexNameLength)
+	case index == "." || index == "..":
+		return fmt.Errorf("'%s' is not an index name", index)
+	case index != strings.ToLower(index):
+		return fmt.Errorf("'%s' must be lowercase", index)
+	case strings.ContainsAny(index, illegalIndexChars):
+		return fmt.Errorf("'%s' must not contain any of %s", index, illegalIndexChars)
+	case strings.HasPrefix(index, "-") || strings.HasPrefix(index, "+") ||
+		(strings.HasPrefix(index, "_") && index != "_all"):
+		return fmt.Errorf("'%s' must not start with -, _ or +", index)
+	}
+	return nil
+}
+
+// ValidateWindowFilter checks the field the time window is filtered by is given.
+func ValidateWindowFilter(windowFilter string) error {
+	if len(strings.TrimSpace(windowFilter)) <= 0 {
+		return errors.New("window filter field is missing")
+	}
+	return nil
+}
+
+// Validate checks every server and role definition in the config file.
+func (c *ConfigurationFile) Validate() error {
+	return c.validate(func(string) bool { return true }, func(string) bool { return true })
+}
+
+// validateChanged checks the server and role definitions added since the last save, leaving the others as they are.
+func (c *ConfigurationFile) validateChanged() error {
+	return c.validate(func(name string) bool { return c.changedServers[name] },
+		func(name string) bool { return c.changedRoles[name] })
+}
+
+func (c *ConfigurationFile) validate(checkServer func(name string) bool, checkRole func(name string) bool) error {
+	for _, name := range c.ServerNames() {
+		server := c.Servers[name]
+		if !checkServer(name) {
+			continue
+		}
+		if err := server.Validate(); err != nil {
+			return fmt.Errorf("server '%s' is invalid: %s. Fix it with configure edit --server=%s", name, err, name)
+		}
+	}
+	for _, name := range c.RoleNames() {
+		role := c.Roles[name]
+		if !checkRole(name) {
+			continue
+		}
+		if err := role.Validate(); err != nil {
+			return fmt.Errorf("role '%s' is invalid: %s. Fix it with configure edit --role=%s", name, err, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestValidateServer(t *testing.T) {
+	valid := Server{Protocol: "https", Hostname: "kibana.test", Port: "5601", KibanaVersion: "7.10.2"}
+	if err := valid.Validate(); err != nil {
+		t.Fatal("Expected server to be valid", err)
+	}
+	tests := []func(server *Server){
+		func(server *Server) { server.Type = "solr" },
+		func(server *Server) { server.Protocol = "ftp" },
+		func(server *Server) { server.Protocol = "" },
+		func(server *Server) { server.Hostname = "" },
+		func(server *Server) { server.Hostname = "https://kibana.test" },
+		func(server *Server) { server.Port = "http" },
+		func(server *Server) { server.Port = "0" },
+		func(server *Server) { server.Port = "65536" },
+		func(server *Server) { server.AuthType = "digest" },
+		func(server *Server) { server.KibanaVersion = "" },
+		func(server *Server) { server.KibanaVersion = "7.10" },
+		func(server *Server) { server.KibanaVersion = "latest" },
+		func(server *Server) { server.ClientCert = "client.pem" },
+	}
+	for _, invalidate := range tests {
+		server := valid
+		invalidate(&server)
+		if err := server.Validate(); err == nil {
+			t.Errorf("Expected server %+v to be invalid", server)
+		}
+	}
+}
+
+func TestValidateElasticsearchServerWithoutVersion(t *testing.T) {
+	server := Server{Type: ElasticsearchServer, Protocol: "http", Hostname: "es.test"}
+	if err := server.Validate(); err != nil {
+		t.Fatal("Kibana version is not needed by elasticsearch servers", err)
+	}
+}
+
+func TestValidateKibanaVersion(t *testing.T) {
+	for _, version := range []string{"6.8.6", "7.10.2", "8.0.0-rc1", "8.11.0+build.1"} {
+		if err := ValidateKibanaVersion(version); err != nil {
+			t.Errorf("Expected version %s to be valid: %s", version, err)
+		}
+	}
+	for _, version := range []string{"7", "7.10", "v7.10.2", "07.10.2", "7.10.2-"} {
+		if err := ValidateKibanaVersion(version); err == nil {
+			t.Errorf("Expected version %s to be invalid", version)
+		}
+	}
+}
+
+func TestValidateIndexPattern(t *testing.T) {
+	valid := []string{"logs-*", "logstash-2021.03.09", ".kibana", "_all", "logs-*,-logs-old", "eu:logs-*,us:logs-*",
+		"*"}
+	for _, pattern := range valid {
+		if err := ValidateIndexPattern(pattern); err != nil {
+			t.Errorf("Expected index pattern %s to be valid: %s", pattern, err)
+		}
+	}
+	invalid := []string{"", "Logs-*", "logs *", "logs/*", "logs|old", "logs#1", "-logs", "_logs", "+logs", ".", "..",
+		"logs-*,", strings.Repeat("a", 256)}
+	for _, pattern := range invalid {
+		if err := ValidateIndexPattern(pattern); err == nil {
+			t.Errorf("Expected index pattern %s to be invalid", pattern)
+		}
+	}
+}
+
+func TestValidateRole(t *testing.T) {
+	if role := (Role{Index: "logs-*", WindowFilter: "@timestamp"}); role.Validate() != nil {
+		t.Error("Expected role to be valid")
+	}
+	if role := (Role{Index: "logs-*"}); role.Validate() == nil {
+		t.Error("Expected role without window filter to be invalid")
+	}
+	if role := (Role{WindowFilter: "@timestamp"}); role.Validate() == nil {
+		t.Error("Expected role without index to be invalid")
+	}
+}
+
+func TestSaveRefusesInvalidConfig(t *testing.T) {
+	file, err := createTempConfig()
+	if err != nil {
+		t.Fatal("Unable to create temp config file", err)
+	}
+	defer os.RemoveAll(file.location.path)
+
+	file.AddServer("invalid", Server{Protocol: "ftp", Hostname: "ftp.test"})
+	if err := file.Save(); err == nil || !strings.Contains(err.Error(), "server 'invalid'") {
+		t.Fatalf("Saving an invalid server must fail, got %v", err)
+	}
+	file.RemoveServer("invalid")
+	file.AddRole("invalid", Role{Index: "Logs", WindowFilter: "@timestamp"})
+	if err := file.Save(); err == nil || !strings.Contains(err.Error(), "role 'invalid'") {
+		t.Fatalf("Saving an invalid role must fail, got %v", err)
+	}
+}
+
+func TestSaveKeepsLegacyConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("/tmp", "ut-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	legacy := `{"servers":{"old":{"hostname":"old.test","protocol":"http","port":"80","kibana_version":"7.9"},` +
+		`"older":{"hostname":"older.test","protocol":"http","port":"80","kibana_version":""}},` +
+		`"roles":{"old":{"index":"Logs","window_filter":"@timestamp"}},"default_server":"old","default_role":"old"}`
+	if err := ioutil.WriteFile(dir+"/kishell-config", []byte(legacy), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	file := LoadConfig(dir + "/kishell-config")
+	file.SetServer("older")
+	file.AddRole("new", Role{Index: "logs-*", WindowFilter: "@timestamp"})
+	if err := file.Save(); err != nil {
+		t.Fatal("Saving must leave the definitions stored by older versions as they are", err)
+	}
+	reloaded := LoadConfig(dir + "/kishell-config")
+	if server, _ := reloaded.FindServer("old"); server.KibanaVersion != "7.9" || reloaded.GetServer() != "older" {
+		t.Errorf("Legacy definitions must be kept as they are, got %+v", server)
+	}
+
+	reloaded.AddServer("old", Server{Protocol: "http", Hostname: "old.test", KibanaVersion: "7.9"})
+	err = reloaded.Save()
+	if err == nil || !strings.Contains(err.Error(), "server 'old'") || !strings.Contains(err.Error(), "configure edit") {
+		t.Fatalf("Saving an invalid server must name it and point to configure edit, got %v", err)
+	}
+}
@@ -0,0 +1,201 @@
+package config
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// VaultPassphraseEnv is the environment variable holding the vault passphrase, so it isn't prompted for.
+	VaultPassphraseEnv = "KISHELL_VAULT_PASSPHRASE"
+	vaultIterations    = 600000
+	vaultMinIterations = 100000
+	vaultKeyLength     = 32
+	vaultSaltLength    = 16
+)
+
+// PassphraseFunc asks for the vault passphrase. Confirm tells the passphrase is asked a second time, to make sure a
+// new vault isn't sealed with a mistyped one.
+type PassphraseFunc func(confirm bool) (string, error)
+
+// Vault keeps secrets in a local file encrypted with AES-256-GCM. The key is derived from a passphrase with
+// PBKDF2-HMAC-SHA256.
+type Vault struct {
+	file       string
+	iterations int
+	passphrase PassphraseFunc
+	key        []byte
+	salt       []byte
+	// created tells the vault file doesn't exist yet, so the passphrase is confirmed before sealing it.
+	created bool
+}
+
+// vaultFile represents the vault file contents. Every byte slice is base64 encoded by encoding/json.
+type vaultFile struct {
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// NewVault creates a vault kept in the file. The passphrase is read from the KISHELL_VAULT_PASSPHRASE environment
+// variable, or asked for once the vault is first opened.
+func NewVault(file string, passphrase PassphraseFunc) *Vault {
+	return &Vault{
+		file:       file,
+		iterations: vaultIterations,
+		passphrase: passphrase,
+	}
+}
+
+// Get fetches the secret value by name.
+func (v *Vault) Get(name string) (string, error) {
+	secrets, err := v.open()
+	if err != nil {
+		return "", err
+	}
+	value, ok := secrets[name]
+	if !ok {
+		return "", fmt.Errorf("secret '%s' not found in vault", name)
+	}
+	return value, nil
+}
+
+// Set stores the secret value by name, creating the vault file if needed.
+func (v *Vault) Set(name string, value string) error {
+	secrets, err := v.open()
+	if err != nil {
+		return err
+	}
+	secrets[name] = value
+	return v.seal(secrets)
+}
+
+// Writable is always true.
+func (v *Vault) Writable() bool {
+	return true
+}
+
+func (v *Vault) open() (map[string]string, error) {
+	content, err := ioutil.ReadFile(v.file)
+	if err != nil && os.IsNotExist(err) {
+		v.created = true
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file vaultFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("vault file '%s' is invalid: %s", v.file, err)
+	}
+	if file.Iterations < vaultMinIterations {
+		return nil, fmt.Errorf("vault file '%s' is invalid: %d key derivation iterations, expected at least %d",
+			v.file, file.Iterations, vaultMinIterations)
+	}
+	v.iterations = file.Iterations
+	gcm, err := v.cipher(file.Salt)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, file.Nonce, file.Ciphertext, nil)
+	if err != nil {
+		return nil, errors.New("unable to open vault: wrong passphrase or corrupted file")
+	}
+	secrets := map[string]string{}
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return nil, err
+	}
+	return secrets, nil
+}
+
+func (v *Vault) seal(secrets map[string]string) error {
+	if v.salt == nil {
+		salt := make([]byte, vaultSaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return err
+		}
+		v.salt = salt
+	}
+	gcm, err := v.cipher(v.salt)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(vaultFile{
+		Iterations: v.iterations,
+		Salt:       v.salt,
+		Nonce:      nonce,
+		Ciphertext: gcm.Seal(nil, nonce, plaintext, nil),
+	})
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(v.file, content, 0600); err != nil {
+		return err
+	}
+	v.created = false
+	return nil
+}
+
+// cipher derives the key out of the passphrase and salt. The passphrase is asked for only once, and confirmed when
+// creating the vault.
+func (v *Vault) cipher(salt []byte) (cipher.AEAD, error) {
+	if v.key == nil || !bytes.Equal(v.salt, salt) {
+		passphrase, err := v.askPassphrase()
+		if err != nil {
+			return nil, err
+		}
+		v.key = pbkdf2.Key([]byte(passphrase), salt, v.iterations, vaultKeyLength, sha256.New)
+		v.salt = salt
+	}
+	block, err := aes.NewCipher(v.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// askPassphrase gets the passphrase out of KISHELL_VAULT_PASSPHRASE, or asks for it otherwise.
+func (v *Vault) askPassphrase() (string, error) {
+	if passphrase, ok := os.LookupEnv(VaultPassphraseEnv); ok {
+		if len(passphrase) <= 0 {
+			return "", errors.New("vault passphrase must not be empty")
+		}
+		return passphrase, nil
+	}
+	passphrase, err := v.passphrase(false)
+	if err != nil {
+		return "", err
+	}
+	if len(passphrase) <= 0 {
+		return "", errors.New("vault passphrase must not be empty")
+	}
+	if v.created {
+		confirmed, err := v.passphrase(true)
+		if err != nil {
+			return "", err
+		}
+		if confirmed != passphrase {
+			return "", errors.New("vault passphrases don't match")
+		}
+	}
+	return passphrase, nil
+}
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestVault(t *testing.T, passphrase string) (*Vault, func()) {
+	dir, err := ioutil.TempDir("", "kishell-vault")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vault := NewVault(filepath.Join(dir, vaultFileName), func(bool) (string, error) {
+		return passphrase, nil
+	})
+	vault.iterations = vaultMinIterations
+	return vault, func() { os.RemoveAll(dir) }
+}
+
+func TestVaultRoundTrip(t *testing.T) {
+	vault, cleanup := newTestVault(t, "correct horse")
+	defer cleanup()
+
+	if err := vault.Set("prod", "dGVzdDpwYXNzd2Q="); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.Set("staging", "c3RhZ2luZw=="); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := ioutil.ReadFile(vault.file)
+	if strings.Contains(string(content), "dGVzdDpwYXNzd2Q=") {
+		t.Fatal("Secrets must not be stored in clear text")
+	}
+
+	reopened := NewVault(vault.file, func(bool) (string, error) {
+		return "correct horse", nil
+	})
+	value, err := reopened.Get("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "dGVzdDpwYXNzd2Q=" {
+		t.Errorf("Unexpected secret value %s", value)
+	}
+	if _, err := reopened.Get("missing"); err == nil {
+		t.Error("Missing secret must be reported")
+	}
+}
+
+func TestVaultWrongPassphrase(t *testing.T) {
+	vault, cleanup := newTestVault(t, "correct horse")
+	defer cleanup()
+	if err := vault.Set("prod", "dGVzdDpwYXNzd2Q="); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := NewVault(vault.file, func(bool) (string, error) {
+		return "battery staple", nil
+	})
+	if _, err := reopened.Get("prod"); err == nil {
+		t.Fatal("Vault must not open with a wrong passphrase")
+	}
+}
+
+func TestVaultPassphraseFromEnv(t *testing.T) {
+	vault, cleanup := newTestVault(t, "")
+	defer cleanup()
+	os.Setenv(VaultPassphraseEnv, "from env")
+	defer os.Unsetenv(VaultPassphraseEnv)
+
+	if err := vault.Set("prod", "token"); err != nil {
+		t.Fatal("Passphrase must be read from the environment", err)
+	}
+}
+
+func TestVaultConfirmsNewPassphrase(t *testing.T) {
+	vault, cleanup := newTestVault(t, "")
+	defer cleanup()
+	answers := map[bool]string{false: "correct horse", true: "correct hrose"}
+	vault.passphrase = func(confirm bool) (string, error) {
+		return answers[confirm], nil
+	}
+	if err := vault.Set("prod", "token"); err == nil || !strings.Contains(err.Error(), "don't match") {
+		t.Fatal("Mistyped passphrases must not seal a new vault", err)
+	}
+	if _, err := os.Stat(vault.file); !os.IsNotExist(err) {
+		t.Fatal("Vault file must not be created")
+	}
+
+	answers[true] = "correct horse"
+	if err := vault.Set("prod", "token"); err != nil {
+		t.Fatal(err)
+	}
+	reopened := NewVault(vault.file, func(confirm bool) (string, error) {
+		if confirm {
+			t.Error("Passphrase must be confirmed for new vaults only")
+		}
+		return "correct horse", nil
+	})
+	if _, err := reopened.Get("prod"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVaultRejectsFewIterations(t *testing.T) {
+	vault, cleanup := newTestVault(t, "correct horse")
+	defer cleanup()
+	if err := vault.Set("prod", "token"); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := ioutil.ReadFile(vault.file)
+	var file vaultFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		t.Fatal(err)
+	}
+	file.Iterations = 1
+	content, _ = json.Marshal(file)
+	if err := ioutil.WriteFile(vault.file, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := NewVault(vault.file, func(bool) (string, error) {
+		return "correct horse", nil
+	})
+	if _, err := reopened.Get("prod"); err == nil || !strings.Contains(err.Error(), "iterations") {
+		t.Fatal("Vault files with too few iterations must be refused", err)
+	}
+}
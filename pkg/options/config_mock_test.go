@@ -1,6 +1,7 @@
 package options
 
 import (
+	"fmt"
 	"github.com/sidilabs/kishell/pkg/config"
 	"github.com/stretchr/testify/mock"
 	"io"
@@ -38,6 +39,20 @@ func (c *ConfigurationMock) AddServer(name string, server config.Server) {
 	c.Called(name, server)
 }
 
+func (c *ConfigurationMock) RemoveServer(name string) {
+	c.Called(name)
+}
+
+func (c *ConfigurationMock) RenameServer(name string, newName string) error {
+	args := c.Called(name, newName)
+	return args.Error(0)
+}
+
+func (c *ConfigurationMock) ServerNames() []string {
+	args := c.Called()
+	return args.Get(0).([]string)
+}
+
 func (c *ConfigurationMock) GetCurrentRole() config.Role {
 	args := c.Called()
 	return args.Get(0).(config.Role)
@@ -61,6 +76,20 @@ func (c *ConfigurationMock) AddRole(name string, role config.Role) {
 	c.Called(name, role)
 }
 
+func (c *ConfigurationMock) RemoveRole(name string) {
+	c.Called(name)
+}
+
+func (c *ConfigurationMock) RenameRole(name string, newName string) error {
+	args := c.Called(name, newName)
+	return args.Error(0)
+}
+
+func (c *ConfigurationMock) RoleNames() []string {
+	args := c.Called()
+	return args.Get(0).([]string)
+}
+
 func (c *ConfigurationMock) Save() error {
 	args := c.Called()
 	return args.Error(0)
@@ -85,3 +114,38 @@ func (c *ConfigurationMock) GetStdin() io.Reader {
 	args := c.Called()
 	return args.Get(0).(io.Reader)
 }
+
+func (c *ConfigurationMock) GetSecrets() config.Secrets {
+	args := c.Called()
+	return args.Get(0).(config.Secrets)
+}
+
+func (c *ConfigurationMock) SetSecrets(secrets config.Secrets) {
+	c.Called(secrets)
+}
+
+func (c *ConfigurationMock) GetSecretBackend(passphrase config.PassphraseFunc) (config.SecretBackend, error) {
+	args := c.Called(mock.Anything)
+	backend, _ := args.Get(0).(config.SecretBackend)
+	return backend, args.Error(1)
+}
+
+// memorySecrets keeps secrets in memory, standing for the vault.
+type memorySecrets map[string]string
+
+func (m memorySecrets) Get(name string) (string, error) {
+	value, ok := m[name]
+	if !ok {
+		return "", fmt.Errorf("secret '%s' not found", name)
+	}
+	return value, nil
+}
+
+func (m memorySecrets) Set(name string, value string) error {
+	m[name] = value
+	return nil
+}
+
+func (m memorySecrets) Writable() bool {
+	return true
+}
@@ -0,0 +1,133 @@
+package options
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sidilabs/kishell/pkg/config"
+)
+
+const missingDefinitionMessage = "missing parameter. One of the following is expected: --server | --role"
+
+// Run the configure edit option.
+// Prompts for each field of the server or role definition with the current values as defaults, and saves it.
+func (e *ConfigureEditCmd) Run(ctx *Context) error {
+	reader := bufio.NewReader(ctx.Configuration.GetStdin())
+	if len(e.Server) > 0 {
+		current, ok := config.Stored(ctx.Configuration).FindServer(e.Server)
+		if !ok {
+			return fmt.Errorf("server '%s' is not a valid option", e.Server)
+		}
+		fmt.Println("Empty answers keep the current value, '-' clears it.")
+		server, err := buildServer(reader, ctx.Configuration, current)
+		if err != nil {
+			return err
+		}
+		ctx.Configuration.AddServer(e.Server, server)
+		return ctx.Configuration.Save()
+	} else if len(e.Role) > 0 {
+		current, ok := config.Stored(ctx.Configuration).FindRole(e.Role)
+		if !ok {
+			return fmt.Errorf("role '%s' is not a valid option", e.Role)
+		}
+		fmt.Println("Empty answers keep the current value, '-' clears it.")
+		ctx.Configuration.AddRole(e.Role, buildRole(reader, current))
+		return ctx.Configuration.Save()
+	}
+	return errors.New(missingDefinitionMessage)
+}
+
+// Run the configure rename option.
+// Renames the server or role definition. It is kept as default if it was.
+func (r *ConfigureRenameCmd) Run(ctx *Context) error {
+	if len(r.Server) > 0 {
+		if err := ctx.Configuration.RenameServer(r.Server, r.To); err != nil {
+			return err
+		}
+		return ctx.Configuration.Save()
+	} else if len(r.Role) > 0 {
+		if err := ctx.Configuration.RenameRole(r.Role, r.To); err != nil {
+			return err
+		}
+		return ctx.Configuration.Save()
+	}
+	return errors.New(missingDefinitionMessage)
+}
+
+// Run the configure remove option.
+// Removes the server or role definition. When it is the current default one, a new default must be picked among the
+// remaining definitions.
+func (r *ConfigureRemoveCmd) Run(ctx *Context) error {
+	configuration := ctx.Configuration
+	if len(r.Server) > 0 {
+		if _, ok := configuration.FindServer(r.Server); !ok {
+			return fmt.Errorf("server '%s' is not a valid option", r.Server)
+		}
+		wasDefault := configuration.GetServer() == r.Server
+		configuration.RemoveServer(r.Server)
+		if wasDefault {
+			name, err := r.pickDefault(configuration, "server", configuration.ServerNames())
+			if err != nil {
+				return err
+			}
+			configuration.SetServer(name)
+		}
+		return configuration.Save()
+	} else if len(r.Role) > 0 {
+		if _, ok := configuration.FindRole(r.Role); !ok {
+			return fmt.Errorf("role '%s' is not a valid option", r.Role)
+		}
+		wasDefault := configuration.GetRole() == r.Role
+		configuration.RemoveRole(r.Role)
+		if wasDefault {
+			name, err := r.pickDefault(configuration, "role", configuration.RoleNames())
+			if err != nil {
+				return err
+			}
+			configuration.SetRole(name)
+		}
+		return configuration.Save()
+	}
+	return errors.New(missingDefinitionMessage)
+}
+
+// pickDefault picks the new default definition among the remaining ones. It is the one given through --default,
+// the only one left, or the one answered to the prompt, which is asked again until a valid name is given.
+func (r *ConfigureRemoveCmd) pickDefault(configuration config.Configuration, kind string,
+	names []string) (string, error) {
+	if len(names) <= 0 {
+		return "", nil
+	}
+	isValid := func(name string) bool {
+		for _, valid := range names {
+			if name == valid {
+				return true
+			}
+		}
+		return false
+	}
+	if len(r.Default) > 0 {
+		if !isValid(r.Default) {
+			return "", fmt.Errorf("%s '%s' is not a valid option", kind, r.Default)
+		}
+		return r.Default, nil
+	}
+	if len(names) == 1 {
+		fmt.Printf("Default %s is now '%s'\n", kind, names[0])
+		return names[0], nil
+	}
+	reader := bufio.NewReader(configuration.GetStdin())
+	for {
+		fmt.Printf("Pick the new default %s (%s): ", kind, strings.Join(names, ", "))
+		name, err := reader.ReadString(lineBreakAsByte)
+		name = strings.TrimSuffix(name, lineBreak)
+		if isValid(name) {
+			return name, nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("a new default %s must be picked. Use --default to give it", kind)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package options
+
+import (
+	"bytes"
+	"errors"
+	"github.com/sidilabs/kishell/pkg/config"
+	"testing"
+)
+
+func TestEditServerKeepsCurrentValues(t *testing.T) {
+	current := config.Server{
+		Protocol:      "http",
+		Hostname:      "ut.test",
+		Port:          "8080",
+		BasicAuth:     "dXQtdXNlcjp1dC1wYXNzd2Q=",
+		KibanaVersion: "6.8.6",
+	}
+	var stdin bytes.Buffer
+	stdin.Write([]byte("\n"))       // server type
+	stdin.Write([]byte("\n"))       // protocol
+	stdin.Write([]byte("ut.new\n")) // hostname
+	stdin.Write([]byte("-\n"))      // port
+	stdin.Write([]byte("\n"))       // auth type
+	stdin.Write([]byte("\n"))       // secret name
+	stdin.Write([]byte("\n"))       // keep credentials?
+	stdin.Write([]byte("7.10.2\n")) // kbn version
+
+	expected := current
+	expected.Hostname = "ut.new"
+	expected.Port = ""
+	expected.KibanaVersion = "7.10.2"
+
+	configuration := new(ConfigurationMock)
+	configuration.On("GetStdin").Return(&stdin)
+	configuration.On("FindServer", "ut-server").Return(current, true)
+	configuration.On("AddServer", "ut-server", expected)
+	configuration.On("Save").Return(nil)
+
+	cmd := ConfigureEditCmd{Server: "ut-server"}
+	if err := cmd.Run(&Context{Configuration: configuration}); err != nil {
+		t.Fatal(err)
+	}
+	configuration.AssertExpectations(t)
+}
+
+func TestEditRole(t *testing.T) {
+	var stdin bytes.Buffer
+	stdin.Write([]byte("ut-new-*\n")) // index pattern
+	stdin.Write([]byte("\n"))         // window filter
+
+	configuration := new(ConfigurationMock)
+	configuration.On("GetStdin").Return(&stdin)
+	configuration.On("FindRole", "ut-role").Return(config.Role{Index: "ut-*", WindowFilter: "@timestamp"}, true)
+	configuration.On("AddRole", "ut-role", config.Role{Index: "ut-new-*", WindowFilter: "@timestamp"})
+	configuration.On("Save").Return(nil)
+
+	cmd := ConfigureEditCmd{Role: "ut-role"}
+	if err := cmd.Run(&Context{Configuration: configuration}); err != nil {
+		t.Fatal(err)
+	}
+	configuration.AssertExpectations(t)
+}
+
+func TestEditIgnoresOverrides(t *testing.T) {
+	current := config.Server{
+		Protocol:      "http",
+		Hostname:      "ut.test",
+		Port:          "8080",
+		BasicAuth:     "dXQtdXNlcjp1dC1wYXNzd2Q=",
+		KibanaVersion: "6.8.6",
+	}
+	var stdin bytes.Buffer
+	stdin.Write([]byte("\n\n\n\n\n\n\n\n")) // keep every server field
+	stdin.Write([]byte("\n\n"))             // keep every role field
+
+	stored := new(ConfigurationMock)
+	stored.On("GetStdin").Return(&stdin)
+	stored.On("FindServer", "ut-server").Return(current, true)
+	stored.On("AddServer", "ut-server", current)
+	stored.On("FindRole", "ut-role").Return(config.Role{Index: "ut-*", WindowFilter: "@timestamp"}, true)
+	stored.On("AddRole", "ut-role", config.Role{Index: "ut-*", WindowFilter: "@timestamp"})
+	stored.On("Save").Return(nil)
+	configuration, err := config.WithOverrides(stored, config.Overrides{
+		ServerURL:    "https://override.test:9243",
+		Username:     "override",
+		Password:     "override",
+		Index:        "override-*",
+		WindowFilter: "event.created",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cmd := range []ConfigureEditCmd{{Server: "ut-server"}, {Role: "ut-role"}} {
+		if err := cmd.Run(&Context{Configuration: configuration}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stored.AssertExpectations(t)
+}
+
+func TestEditMissingServer(t *testing.T) {
+	configuration := new(ConfigurationMock)
+	configuration.On("GetStdin").Return(&bytes.Buffer{})
+	configuration.On("FindServer", "missing").Return(config.Server{}, false)
+
+	cmd := ConfigureEditCmd{Server: "missing"}
+	if err := cmd.Run(&Context{Configuration: configuration}); err == nil {
+		t.Fatal("Editing a missing server must fail")
+	}
+}
+
+func TestRenameServer(t *testing.T) {
+	configuration := new(ConfigurationMock)
+	configuration.On("RenameServer", "ut-server", "ut-renamed").Return(nil)
+	configuration.On("Save").Return(nil)
+
+	cmd := ConfigureRenameCmd{Server: "ut-server", To: "ut-renamed"}
+	if err := cmd.Run(&Context{Configuration: configuration}); err != nil {
+		t.Fatal(err)
+	}
+	configuration.AssertExpectations(t)
+}
+
+func TestRenameRoleFailure(t *testing.T) {
+	configuration := new(ConfigurationMock)
+	configuration.On("RenameRole", "ut-role", "ut-taken").Return(errors.New("role 'ut-taken' already exists"))
+
+	cmd := ConfigureRenameCmd{Role: "ut-role", To: "ut-taken"}
+	if err := cmd.Run(&Context{Configuration: configuration}); err == nil {
+		t.Fatal("Rename failures must be reported")
+	}
+	configuration.AssertNotCalled(t, "Save")
+}
+
+func TestRemoveServer(t *testing.T) {
+	configuration := new(ConfigurationMock)
+	configuration.On("FindServer", "ut-other").Return(config.Server{}, true)
+	configuration.On("GetServer").Return("ut-server")
+	configuration.On("RemoveServer", "ut-other")
+	configuration.On("Save").Return(nil)
+
+	cmd := ConfigureRemoveCmd{Server: "ut-other"}
+	if err := cmd.Run(&Context{Configuration: configuration}); err != nil {
+		t.Fatal(err)
+	}
+	configuration.AssertExpectations(t)
+	configuration.AssertNotCalled(t, "SetServer", "ut-server")
+}
+
+func TestRemoveDefaultServerPromptsForNewDefault(t *testing.T) {
+	var stdin bytes.Buffer
+	stdin.Write([]byte("ut-missing\n")) // invalid answer asked again
+	stdin.Write([]byte("ut-eu\n"))      // new default
+
+	configuration := new(ConfigurationMock)
+	configuration.On("GetStdin").Return(&stdin)
+	configuration.On("FindServer", "ut-server").Return(config.Server{}, true)
+	configuration.On("GetServer").Return("ut-server")
+	configuration.On("RemoveServer", "ut-server")
+	configuration.On("ServerNames").Return([]string{"ut-ap", "ut-eu"})
+	configuration.On("SetServer", "ut-eu")
+	configuration.On("Save").Return(nil)
+
+	cmd := ConfigureRemoveCmd{Server: "ut-server"}
+	if err := cmd.Run(&Context{Configuration: configuration}); err != nil {
+		t.Fatal(err)
+	}
+	configuration.AssertExpectations(t)
+}
+
+func TestRemoveDefaultRoleWithoutAnswer(t *testing.T) {
+	configuration := new(ConfigurationMock)
+	configuration.On("GetStdin").Return(&bytes.Buffer{})
+	configuration.On("FindRole", "ut-role").Return(config.Role{}, true)
+	configuration.On("GetRole").Return("ut-role")
+	configuration.On("RemoveRole", "ut-role")
+	configuration.On("RoleNames").Return([]string{"ut-a", "ut-b"})
+
+	cmd := ConfigureRemoveCmd{Role: "ut-role"}
+	if err := cmd.Run(&Context{Configuration: configuration}); err == nil {
+		t.Fatal("A new default role must be picked")
+	}
+	configuration.AssertNotCalled(t, "Save")
+}
+
+func TestRemoveDefaultRoleWithDefaultFlag(t *testing.T) {
+	configuration := new(ConfigurationMock)
+	configuration.On("FindRole", "ut-role").Return(config.Role{}, true)
+	configuration.On("GetRole").Return("ut-role")
+	configuration.On("RemoveRole", "ut-role")
+	configuration.On("RoleNames").Return([]string{"ut-a", "ut-b"})
+	configuration.On("SetRole", "ut-b")
+	configuration.On("Save").Return(nil)
+
+	cmd := ConfigureRemoveCmd{Role: "ut-role", Default: "ut-b"}
+	if err := cmd.Run(&Context{Configuration: configuration}); err != nil {
+		t.Fatal(err)
+	}
+	configuration.AssertExpectations(t)
+}
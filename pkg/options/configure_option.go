@@ -6,69 +6,380 @@ import (
 	"errors"
 	"fmt"
 	"github.com/sidilabs/kishell/pkg/config"
+	"golang.org/x/term"
+	"io"
+	"os"
 	"strings"
 )
 
 const (
-	lineBreak       = "\n"
-	lineBreakAsByte = '\n'
+	lineBreak           = "\n"
+	lineBreakAsByte     = '\n'
+	defaultWindowFilter = "@timestamp"
+	clearAnswer         = "-"
 )
 
-// Run the configure option.
-// It can configure both server and role definitions.
-// Saves each definition in the config file.
-func (c *ConfigureCmd) Run(ctx *Context) error {
-	if c.Server {
-		addServer(ctx.Configuration)
+// Run the configure server option.
+// Prompts for each field of the server definition, unless a name is given through flags, then the fields are taken
+// from flags. Saves the definition in the config file.
+func (c *ConfigureServerCmd) Run(ctx *Context) error {
+	if len(c.Name) <= 0 {
+		if err := addServer(ctx.Configuration); err != nil {
+			return err
+		}
 		return ctx.Configuration.Save()
-	} else if c.Role {
+	}
+	server, err := c.build(ctx.Configuration)
+	if err != nil {
+		return err
+	}
+	ctx.Configuration.AddServer(c.Name, server)
+	if c.Default || len(ctx.Configuration.GetServer()) <= 0 {
+		ctx.Configuration.SetServer(c.Name)
+	}
+	return ctx.Configuration.Save()
+}
+
+// Run the configure role option.
+// Prompts for each field of the role definition, unless a name is given through flags, then the fields are taken
+// from flags. Saves the definition in the config file.
+func (c *ConfigureRoleCmd) Run(ctx *Context) error {
+	if len(c.Name) <= 0 {
 		addRole(ctx.Configuration)
 		return ctx.Configuration.Save()
-	} else if c.Reset {
-		return ctx.Configuration.Reset()
 	}
-	return errors.New("missing parameter. One of the following is expected: --server | --role")
+	if len(c.overrides.Index) <= 0 {
+		return errors.New("index is missing. Use --index to give the index pattern")
+	}
+	role := config.Role{
+		Index:        c.overrides.Index,
+		WindowFilter: c.overrides.WindowFilter,
+	}
+	if len(role.WindowFilter) <= 0 {
+		role.WindowFilter = defaultWindowFilter
+	}
+	if err := role.Validate(); err != nil {
+		return err
+	}
+	ctx.Configuration.AddRole(c.Name, role)
+	if c.Default || len(ctx.Configuration.GetRole()) <= 0 {
+		ctx.Configuration.SetRole(c.Name)
+	}
+	return ctx.Configuration.Save()
+}
+
+// Run the configure secrets option.
+// Prompts for the secret backend server credentials are stored in.
+func (c *ConfigureSecretsCmd) Run(ctx *Context) error {
+	configureSecrets(ctx.Configuration)
+	return ctx.Configuration.Save()
 }
 
-func addServer(configuration config.Configuration) {
+// Run the configure reset option.
+// Resets the whole config file.
+func (c *ConfigureResetCmd) Run(ctx *Context) error {
+	return ctx.Configuration.Reset()
+}
+
+// build builds the server definition out of flags, reporting invalid ones. Credentials are stored in the secret
+// backend when a secret name is given, or referenced only when none is given along.
+func (c *ConfigureServerCmd) build(configuration config.Configuration) (config.Server, error) {
+	serverURL := c.URL
+	if len(serverURL) <= 0 {
+		serverURL = c.overrides.ServerURL
+	}
+	if len(serverURL) <= 0 {
+		return config.Server{}, errors.New("server URL is missing. Use --url to give it")
+	}
+	endpoint, err := config.ParseServerURL(serverURL)
+	if err != nil {
+		return config.Server{}, err
+	}
+	serverType := c.Type
+	if len(serverType) <= 0 {
+		serverType = c.overrides.ServerType
+	}
+	credentials, err := c.credentials()
+	if err != nil {
+		return config.Server{}, err
+	}
+	server := config.Server{
+		Type:                 serverType,
+		Protocol:             endpoint.Scheme,
+		Hostname:             endpoint.Hostname(),
+		Port:                 endpoint.Port(),
+		KibanaVersion:        c.overrides.KibanaVersion,
+		ElasticsearchVersion: c.overrides.ElasticsearchVersion,
+		AuthType:             c.AuthType,
+		Secret:               c.Secret,
+		CAFile:               c.CAFile,
+		ClientCert:           c.ClientCert,
+		ClientKey:            c.ClientKey,
+		InsecureSkipVerify:   c.InsecureSkipVerify,
+	}
+	if err := server.Validate(); err != nil {
+		return config.Server{}, err
+	}
+	if len(c.Secret) > 0 {
+		if len(credentials) > 0 {
+			stdin := configuration.GetStdin()
+			backend, err := configuration.GetSecretBackend(askPassphrase(stdin, bufio.NewReader(stdin)))
+			if err != nil {
+				return config.Server{}, err
+			}
+			if err := backend.Set(c.Secret, credentials); err != nil {
+				return config.Server{}, fmt.Errorf("unable to store secret '%s': %s", c.Secret, err)
+			}
+		}
+	} else if server.GetAuthType() == config.BasicAuth {
+		server.BasicAuth = credentials
+	} else {
+		server.Token = credentials
+	}
+	return server, nil
+}
+
+// credentials gives the base64 encoded username and password for basic authentication, or the token otherwise.
+func (c *ConfigureServerCmd) credentials() (string, error) {
+	switch c.AuthType {
+	case "", config.BasicAuth:
+		if len(c.Token) > 0 {
+			return "", errors.New("--token is only used along --auth-type=apikey or --auth-type=bearer")
+		}
+		username := c.User
+		if len(username) <= 0 {
+			username = c.overrides.Username
+		}
+		if len(username) <= 0 && len(c.overrides.Password) <= 0 {
+			return "", nil
+		}
+		return base64.StdEncoding.EncodeToString([]byte(username + ":" + c.overrides.Password)), nil
+	case config.APIKeyAuth, config.BearerAuth:
+		if len(c.Token) <= 0 && len(c.Secret) <= 0 {
+			return "", fmt.Errorf("token is missing. Use --token to give it along --auth-type=%s", c.AuthType)
+		}
+		return c.Token, nil
+	}
+	return "", fmt.Errorf("authentication type '%s' is invalid. Expected basic, apikey or bearer", c.AuthType)
+}
+
+func addServer(configuration config.Configuration) error {
 	reader := bufio.NewReader(configuration.GetStdin())
 	fmt.Print("Server name: ")
 	serverName, _ := reader.ReadString(lineBreakAsByte)
 	serverName = strings.TrimSuffix(serverName, lineBreak)
-	configuration.AddServer(serverName, buildServer(reader))
+	server, err := buildServer(reader, configuration, config.Server{})
+	if err != nil {
+		return err
+	}
+	configuration.AddServer(serverName, server)
 	fmt.Print("Set as default? [Y/n]: ")
 	defaultServer, _ := reader.ReadString(lineBreakAsByte)
 	defaultServer = strings.TrimSuffix(defaultServer, lineBreak)
 	if len(configuration.GetServer()) <= 0 || len(defaultServer) <= 0 || (defaultServer == "Y" || defaultServer == "y") {
 		configuration.SetServer(serverName)
 	}
+	return nil
+}
+
+// buildServer prompts for each field of the server definition. The current definition values are kept on empty
+// answers, so the same prompts add new servers, starting from an empty definition, and edit existing ones.
+func buildServer(reader *bufio.Reader, configuration config.Configuration, current config.Server) (config.Server, error) {
+	server := current
+	server.Type = askValid(reader, "Server type (kibana, elasticsearch)", current.Type, config.KibanaServer,
+		config.ValidateServerType)
+	server.Protocol = askValid(reader, "Protocol", current.Protocol, "", config.ValidateProtocol)
+	server.Hostname = askValid(reader, "Hostname", current.Hostname, "", config.ValidateHostname)
+	server.Port = askValid(reader, "Port", current.Port, "", config.ValidatePort)
+	server.AuthType = askValid(reader, "Authentication type (basic, apikey, bearer)", current.AuthType, config.BasicAuth,
+		config.ValidateAuthType)
+	server.Secret = ask(reader, "Secret name (leave empty to keep credentials in the config file)", current.Secret, "")
+	if !keepCredentials(reader, current, server) {
+		basicAuth, token, err := readSecretCredentials(reader, configuration, server.AuthType, server.Secret)
+		if err != nil {
+			return config.Server{}, err
+		}
+		server.BasicAuth = basicAuth
+		server.Token = token
+	}
+	server.KibanaVersion = ""
+	server.ElasticsearchVersion = ""
+	if server.Type != config.ElasticsearchServer {
+		server.KibanaVersion = askValid(reader, "Kibana Version", current.KibanaVersion, "", config.ValidateKibanaVersion)
+	} else {
+		server.ElasticsearchVersion = askValid(reader, "Elasticsearch Version", current.ElasticsearchVersion, "",
+			config.ValidateElasticsearchVersion)
+	}
+	if server.Protocol == "https" {
+		readTLS(reader, &server)
+	}
+	return server, nil
+}
+
+// ask prompts for a field showing its current value, or the default one otherwise, between brackets. Empty answers
+// keep the current value, and a single dash clears it.
+func ask(reader *bufio.Reader, label string, current string, defaultValue string) string {
+	return askValid(reader, label, current, defaultValue, nil)
+}
+
+// askValid prompts for a field like ask does, asking again while the answer is invalid. The answer is given as is
+// once the input is over, so an invalid definition is then refused on save.
+func askValid(reader *bufio.Reader, label string, current string, defaultValue string,
+	validate func(string) error) string {
+	shown := current
+	if len(shown) <= 0 {
+		shown = defaultValue
+	}
+	for {
+		if len(shown) > 0 {
+			fmt.Printf("%s [%s]: ", label, shown)
+		} else {
+			fmt.Printf("%s: ", label)
+		}
+		answer, err := reader.ReadString(lineBreakAsByte)
+		answer = strings.TrimSuffix(answer, lineBreak)
+		if answer == clearAnswer {
+			answer = ""
+		} else if len(answer) <= 0 {
+			answer = current
+		}
+		if validate == nil || err != nil {
+			return answer
+		}
+		invalid := validate(answer)
+		if invalid == nil {
+			return answer
+		}
+		fmt.Println(invalid)
+	}
+}
+
+// keepCredentials asks whether the credentials of a server being edited are kept. They can only be kept as long as
+// the authentication type and secret are left as they were.
+func keepCredentials(reader *bufio.Reader, current config.Server, server config.Server) bool {
+	hasCredentials := len(current.BasicAuth) > 0 || len(current.Token) > 0 || len(current.Secret) > 0
+	if !hasCredentials || current.AuthType != server.AuthType || current.Secret != server.Secret {
+		return false
+	}
+	fmt.Print("Keep current credentials? [Y/n]: ")
+	answer, _ := reader.ReadString(lineBreakAsByte)
+	answer = strings.TrimSuffix(answer, lineBreak)
+	return len(answer) <= 0 || answer == "Y" || answer == "y"
+}
+
+// readSecretCredentials prompts for the credentials, storing them in the secret backend when the server references a
+// secret. Nothing is prompted for when the backend can't store secrets, they are expected to be there already.
+func readSecretCredentials(reader *bufio.Reader, configuration config.Configuration, authType string,
+	secret string) (string, string, error) {
+	if len(secret) <= 0 {
+		basicAuth, token := readCredentials(reader, authType)
+		return basicAuth, token, nil
+	}
+	backend, err := configuration.GetSecretBackend(askPassphrase(configuration.GetStdin(), reader))
+	if err != nil {
+		return "", "", err
+	}
+	if !backend.Writable() {
+		return "", "", nil
+	}
+	basicAuth, token := readCredentials(reader, authType)
+	value := token
+	if len(basicAuth) > 0 {
+		value = basicAuth
+	}
+	return "", "", backend.Set(secret, value)
 }
 
-func buildServer(reader *bufio.Reader) config.Server {
-	fmt.Print("Protocol: ")
-	protocol, _ := reader.ReadString(lineBreakAsByte)
-	fmt.Print("Hostname: ")
-	hostname, _ := reader.ReadString(lineBreakAsByte)
-	fmt.Print("Port: ")
-	port, _ := reader.ReadString(lineBreakAsByte)
+// askPassphrase prompts for the vault passphrase. The prompt goes to stderr, so it doesn't mix with search results.
+// The passphrase isn't echoed when stdin is a terminal, and read from the reader like any other answer otherwise.
+func askPassphrase(stdin io.Reader, reader *bufio.Reader) config.PassphraseFunc {
+	return func(confirm bool) (string, error) {
+		if confirm {
+			fmt.Fprint(os.Stderr, "Confirm vault passphrase: ")
+		} else {
+			fmt.Fprint(os.Stderr, "Vault passphrase: ")
+		}
+		if file, ok := stdin.(*os.File); ok && term.IsTerminal(int(file.Fd())) {
+			passphrase, err := term.ReadPassword(int(file.Fd()))
+			fmt.Fprintln(os.Stderr)
+			return string(passphrase), err
+		}
+		passphrase, err := reader.ReadString(lineBreakAsByte)
+		if err != nil && len(passphrase) <= 0 {
+			return "", err
+		}
+		return strings.TrimSuffix(passphrase, lineBreak), nil
+	}
+}
+
+// configureSecrets prompts for the secret backend server credentials are stored in.
+func configureSecrets(configuration config.Configuration) {
+	reader := bufio.NewReader(configuration.GetStdin())
+	fmt.Print("Secret backend (vault, exec) [vault]: ")
+	backend, _ := reader.ReadString(lineBreakAsByte)
+	secrets := config.Secrets{
+		Backend: strings.TrimSuffix(backend, lineBreak),
+	}
+	if secrets.GetBackend() == config.ExecSecrets {
+		fmt.Print("Helper command, given the secret name as last argument (e.g. secret-tool lookup kishell): ")
+		command, _ := reader.ReadString(lineBreakAsByte)
+		secrets.Command = strings.TrimSuffix(command, lineBreak)
+	} else {
+		fmt.Print("Vault file (optional): ")
+		vaultFile, _ := reader.ReadString(lineBreakAsByte)
+		secrets.VaultFile = strings.TrimSuffix(vaultFile, lineBreak)
+	}
+	configuration.SetSecrets(secrets)
+}
+
+// readTLS prompts for the optional TLS settings of https servers. Empty answers keep the system defaults, or the
+// current settings of a server being edited.
+func readTLS(reader *bufio.Reader, server *config.Server) {
+	server.CAFile = ask(reader, "CA file (optional)", server.CAFile, "")
+	server.ClientCert = ask(reader, "Client certificate (optional)", server.ClientCert, "")
+	server.ClientKey = ask(reader, "Client key (optional)", server.ClientKey, "")
+	if server.InsecureSkipVerify {
+		fmt.Print("Skip certificate verification? [Y/n]: ")
+	} else {
+		fmt.Print("Skip certificate verification? [y/N]: ")
+	}
+	skipVerify, _ := reader.ReadString(lineBreakAsByte)
+	skipVerify = strings.TrimSuffix(skipVerify, lineBreak)
+	if len(skipVerify) > 0 {
+		server.InsecureSkipVerify = skipVerify == "Y" || skipVerify == "y"
+	}
+}
+
+// readCredentials prompts for the credentials matching the authentication type. It gives the base64 encoded
+// username and password for basic authentication, or the token otherwise. API keys are encoded out of their id and
+// key, unless the id is left empty and the key is given already encoded.
+func readCredentials(reader *bufio.Reader, authType string) (string, string) {
+	switch authType {
+	case config.APIKeyAuth:
+		fmt.Print("API key id: ")
+		id, _ := reader.ReadString(lineBreakAsByte)
+		fmt.Print("API key: ")
+		apiKey, _ := reader.ReadString(lineBreakAsByte)
+		id = strings.TrimSuffix(id, lineBreak)
+		apiKey = strings.TrimSuffix(apiKey, lineBreak)
+		if len(id) <= 0 {
+			return "", apiKey
+		}
+		return "", base64.StdEncoding.EncodeToString([]byte(id + ":" + apiKey))
+	case config.BearerAuth:
+		fmt.Print("Token: ")
+		token, _ := reader.ReadString(lineBreakAsByte)
+		return "", strings.TrimSuffix(token, lineBreak)
+	}
 	fmt.Print("Username: ")
 	username, _ := reader.ReadString(lineBreakAsByte)
 	fmt.Print("Password: ")
 	password, _ := reader.ReadString(lineBreakAsByte)
-	fmt.Print("Kibana Version: ")
-	kibanaVersion, _ := reader.ReadString(lineBreakAsByte)
 	basicAuth := strings.TrimSuffix(username, lineBreak) + ":" + strings.TrimSuffix(password, lineBreak)
 	if len(basicAuth) <= 1 {
 		basicAuth = ""
 	}
-	server := config.Server{
-		Protocol:      strings.TrimSuffix(protocol, lineBreak),
-		Hostname:      strings.TrimSuffix(hostname, lineBreak),
-		Port:          strings.TrimSuffix(port, lineBreak),
-		BasicAuth:     base64.StdEncoding.EncodeToString([]byte(basicAuth)),
-		KibanaVersion: strings.TrimSuffix(kibanaVersion, lineBreak),
-	}
-	return server
+	return base64.StdEncoding.EncodeToString([]byte(basicAuth)), ""
 }
 
 func addRole(configuration config.Configuration) {
@@ -76,7 +387,7 @@ func addRole(configuration config.Configuration) {
 	fmt.Print("Role name: ")
 	roleName, _ := reader.ReadString(lineBreakAsByte)
 	roleName = strings.TrimSuffix(roleName, lineBreak)
-	configuration.AddRole(roleName, buildRole(reader))
+	configuration.AddRole(roleName, buildRole(reader, config.Role{}))
 	fmt.Print("Set as default? [Y/n]: ")
 	defaultRole, _ := reader.ReadString(lineBreakAsByte)
 	defaultRole = strings.TrimSuffix(defaultRole, lineBreak)
@@ -85,14 +396,13 @@ func addRole(configuration config.Configuration) {
 	}
 }
 
-func buildRole(reader *bufio.Reader) config.Role {
-	fmt.Print("Index name: ")
-	index, _ := reader.ReadString(lineBreakAsByte)
-	fmt.Print("Window filter time (e.g. @timestamp, modified_date): ")
-	windowFilter, _ := reader.ReadString(lineBreakAsByte)
-	role := config.Role{
-		Index:        strings.TrimSuffix(index, lineBreak),
-		WindowFilter: strings.TrimSuffix(windowFilter, lineBreak),
+// buildRole prompts for each field of the role definition, keeping the current values on empty answers.
+func buildRole(reader *bufio.Reader, current config.Role) config.Role {
+	index := askValid(reader, "Index name", current.Index, "", config.ValidateIndexPattern)
+	windowFilter := askValid(reader, "Window filter time (e.g. @timestamp, modified_date)", current.WindowFilter, "",
+		config.ValidateWindowFilter)
+	return config.Role{
+		Index:        index,
+		WindowFilter: windowFilter,
 	}
-	return role
 }
@@ -3,6 +3,7 @@ package options
 import (
 	"bytes"
 	"fmt"
+	"github.com/sidilabs/kishell/pkg/config"
 	"github.com/stretchr/testify/mock"
 	"testing"
 )
@@ -11,9 +12,12 @@ func TestAddServerConfig(t *testing.T) {
 	serverName := "ut-server"
 	var stdin bytes.Buffer
 	stdin.Write([]byte(serverName + "\n")) // server name
+	stdin.Write([]byte("\n"))              // server type
 	stdin.Write([]byte("http\n"))          // protocol
 	stdin.Write([]byte("ut.test\n"))       // hostname
 	stdin.Write([]byte("8080\n"))          // port
+	stdin.Write([]byte("\n"))              // auth type
+	stdin.Write([]byte("\n"))              // secret name
 	stdin.Write([]byte("ut-user\n"))       // username
 	stdin.Write([]byte("ut-passwd\n"))     // passwd
 	stdin.Write([]byte("6.4.3\n"))         // kbn version
@@ -31,9 +35,129 @@ func TestAddServerConfig(t *testing.T) {
 		Configuration: configuration,
 	}
 
-	cmd := ConfigureCmd{
-		Server: true,
+	cmd := ConfigureServerCmd{}
+
+	err := cmd.Run(&context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configuration.AssertExpectations(t)
+	fmt.Printf(lineBreak)
+}
+
+func TestAddTLSServerConfig(t *testing.T) {
+	serverName := "ut-tls-server"
+	var stdin bytes.Buffer
+	stdin.Write([]byte(serverName + "\n"))          // server name
+	stdin.Write([]byte("elasticsearch\n"))          // server type
+	stdin.Write([]byte("https\n"))                  // protocol
+	stdin.Write([]byte("ut.test\n"))                // hostname
+	stdin.Write([]byte("\n"))                       // port
+	stdin.Write([]byte("bearer\n"))                 // auth type
+	stdin.Write([]byte("\n"))                       // secret name
+	stdin.Write([]byte("ut-token\n"))               // token
+	stdin.Write([]byte("8.11.1\n"))                 // elasticsearch version
+	stdin.Write([]byte("/etc/ssl/ut-ca.pem\n"))     // CA file
+	stdin.Write([]byte("/etc/ssl/ut-client.pem\n")) // client certificate
+	stdin.Write([]byte("/etc/ssl/ut-client.key\n")) // client key
+	stdin.Write([]byte("\n"))                       // skip verification?
+	stdin.Write([]byte("n\n"))                      // is default?
+
+	expected := config.Server{
+		Type:                 config.ElasticsearchServer,
+		Protocol:             "https",
+		Hostname:             "ut.test",
+		AuthType:             config.BearerAuth,
+		Token:                "ut-token",
+		ElasticsearchVersion: "8.11.1",
+		CAFile:               "/etc/ssl/ut-ca.pem",
+		ClientCert:           "/etc/ssl/ut-client.pem",
+		ClientKey:            "/etc/ssl/ut-client.key",
+	}
+	configuration := new(ConfigurationMock)
+	configuration.On("GetStdin").Return(&stdin)
+	configuration.On("AddServer", serverName, expected)
+	configuration.On("GetServer").Return("ut-server")
+	configuration.On("Save").Return(nil)
+
+	context := Context{
+		Debug:         true,
+		Configuration: configuration,
+	}
+
+	cmd := ConfigureServerCmd{}
+
+	err := cmd.Run(&context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configuration.AssertExpectations(t)
+	fmt.Printf(lineBreak)
+}
+
+func TestAddServerWithSecretConfig(t *testing.T) {
+	serverName := "ut-secret-server"
+	var stdin bytes.Buffer
+	stdin.Write([]byte(serverName + "\n")) // server name
+	stdin.Write([]byte("\n"))              // server type
+	stdin.Write([]byte("http\n"))          // protocol
+	stdin.Write([]byte("ut.test\n"))       // hostname
+	stdin.Write([]byte("8080\n"))          // port
+	stdin.Write([]byte("\n"))              // auth type
+	stdin.Write([]byte("ut-secret\n"))     // secret name
+	stdin.Write([]byte("ut-user\n"))       // username
+	stdin.Write([]byte("ut-passwd\n"))     // passwd
+	stdin.Write([]byte("7.17.0\n"))        // kbn version
+	stdin.Write([]byte("n\n"))             // is default?
+
+	secrets := memorySecrets{}
+	configuration := new(ConfigurationMock)
+	configuration.On("GetStdin").Return(&stdin)
+	configuration.On("GetSecretBackend", mock.Anything).Return(secrets, nil)
+	configuration.On("AddServer", serverName, config.Server{
+		Protocol:      "http",
+		Hostname:      "ut.test",
+		Port:          "8080",
+		Secret:        "ut-secret",
+		KibanaVersion: "7.17.0",
+	})
+	configuration.On("GetServer").Return("ut-server")
+	configuration.On("Save").Return(nil)
+
+	context := Context{
+		Debug:         true,
+		Configuration: configuration,
+	}
+
+	cmd := ConfigureServerCmd{}
+
+	err := cmd.Run(&context)
+	if err != nil {
+		t.Fatal(err)
 	}
+	configuration.AssertExpectations(t)
+	if secrets["ut-secret"] != "dXQtdXNlcjp1dC1wYXNzd2Q=" {
+		t.Errorf("Credentials must be stored in the secret backend, got %v", secrets)
+	}
+	fmt.Printf(lineBreak)
+}
+
+func TestConfigureSecrets(t *testing.T) {
+	var stdin bytes.Buffer
+	stdin.Write([]byte("exec\n"))                       // secret backend
+	stdin.Write([]byte("secret-tool lookup kishell\n")) // helper command
+
+	configuration := new(ConfigurationMock)
+	configuration.On("GetStdin").Return(&stdin)
+	configuration.On("SetSecrets", config.Secrets{Backend: config.ExecSecrets, Command: "secret-tool lookup kishell"})
+	configuration.On("Save").Return(nil)
+
+	context := Context{
+		Debug:         true,
+		Configuration: configuration,
+	}
+
+	cmd := ConfigureSecretsCmd{}
 
 	err := cmd.Run(&context)
 	if err != nil {
@@ -43,6 +167,47 @@ func TestAddServerConfig(t *testing.T) {
 	fmt.Printf(lineBreak)
 }
 
+func TestAddServerConfigAsksAgainOnInvalidAnswers(t *testing.T) {
+	serverName := "ut-server"
+	var stdin bytes.Buffer
+	stdin.Write([]byte(serverName + "\n")) // server name
+	stdin.Write([]byte("solr\n"))          // invalid server type
+	stdin.Write([]byte("\n"))              // server type
+	stdin.Write([]byte("ftp\n"))           // invalid protocol
+	stdin.Write([]byte("http\n"))          // protocol
+	stdin.Write([]byte("\n"))              // missing hostname
+	stdin.Write([]byte("ut.test\n"))       // hostname
+	stdin.Write([]byte("99999\n"))         // invalid port
+	stdin.Write([]byte("8080\n"))          // port
+	stdin.Write([]byte("\n"))              // auth type
+	stdin.Write([]byte("\n"))              // secret name
+	stdin.Write([]byte("\n"))              // username
+	stdin.Write([]byte("\n"))              // passwd
+	stdin.Write([]byte("latest\n"))        // invalid kbn version
+	stdin.Write([]byte("7.10.2\n"))        // kbn version
+	stdin.Write([]byte("y\n"))             // is default?
+
+	configuration := new(ConfigurationMock)
+	configuration.On("GetStdin").Return(&stdin)
+	configuration.On("AddServer", serverName, config.Server{
+		Protocol:      "http",
+		Hostname:      "ut.test",
+		Port:          "8080",
+		KibanaVersion: "7.10.2",
+	})
+	configuration.On("GetServer").Return(serverName)
+	configuration.On("SetServer", serverName)
+	configuration.On("Save").Return(nil)
+
+	cmd := ConfigureServerCmd{}
+	err := cmd.Run(&Context{Configuration: configuration})
+	if err != nil {
+		t.Fatal(err)
+	}
+	configuration.AssertExpectations(t)
+	fmt.Printf(lineBreak)
+}
+
 func TestAddRoleConfig(t *testing.T) {
 	roleName := "ut-role"
 
@@ -64,9 +229,7 @@ func TestAddRoleConfig(t *testing.T) {
 		Configuration: configuration,
 	}
 
-	cmd := ConfigureCmd{
-		Role: true,
-	}
+	cmd := ConfigureRoleCmd{}
 	err := cmd.Run(&context)
 	if err != nil {
 		t.Fatal(err)
@@ -75,14 +238,127 @@ func TestAddRoleConfig(t *testing.T) {
 	fmt.Printf(lineBreak)
 }
 
-func TestInvalidConfigurationOption(t *testing.T) {
+func TestAddServerConfigFromFlags(t *testing.T) {
+	configuration := new(ConfigurationMock)
+	configuration.On("AddServer", "prod", config.Server{
+		Protocol:      "https",
+		Hostname:      "kibana",
+		Port:          "5601",
+		KibanaVersion: "7.9.3",
+		BasicAuth:     "dXQtdXNlcjp1dC1wYXNzd2Q=",
+	})
+	configuration.On("SetServer", "prod")
+	configuration.On("Save").Return(nil)
+
+	context := Context{
+		Debug:         true,
+		Configuration: configuration,
+	}
+	cmd := ConfigureServerCmd{
+		Name:    "prod",
+		URL:     "https://kibana:5601",
+		User:    "ut-user",
+		Default: true,
+		overrides: config.Overrides{
+			Password:      "ut-passwd",
+			KibanaVersion: "7.9.3",
+		},
+	}
+
+	err := cmd.Run(&context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configuration.AssertExpectations(t)
+}
+
+func TestAddServerConfigFromEnv(t *testing.T) {
+	configuration := new(ConfigurationMock)
+	configuration.On("AddServer", "ci", config.Server{
+		Type:     config.ElasticsearchServer,
+		Protocol: "http",
+		Hostname: "es.ci",
+		AuthType: config.APIKeyAuth,
+		Token:    "aWQ6a2V5",
+	})
+	configuration.On("GetServer").Return("")
+	configuration.On("SetServer", "ci")
+	configuration.On("Save").Return(nil)
+
+	context := Context{
+		Debug:         true,
+		Configuration: configuration,
+	}
+	cmd := ConfigureServerCmd{
+		Name:     "ci",
+		AuthType: config.APIKeyAuth,
+		Token:    "aWQ6a2V5",
+		overrides: config.Overrides{
+			ServerURL:  "http://es.ci",
+			ServerType: config.ElasticsearchServer,
+		},
+	}
+
+	err := cmd.Run(&context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configuration.AssertExpectations(t)
+}
+
+func TestInvalidServerFlags(t *testing.T) {
+	tests := []ConfigureServerCmd{
+		{Name: "prod"},
+		{Name: "prod", URL: "kibana:5601"},
+		{Name: "prod", URL: "https://kibana:5601", Type: "solr"},
+		{Name: "prod", URL: "https://kibana:5601", AuthType: "digest"},
+		{Name: "prod", URL: "https://kibana:5601", AuthType: config.BearerAuth},
+		{Name: "prod", URL: "https://kibana:5601", Token: "token"},
+		{Name: "prod", URL: "https://kibana:5601", ClientCert: "client.pem"},
+		{Name: "prod", URL: "https://kibana:5601"},
+		{Name: "prod", URL: "https://kibana:70000", overrides: config.Overrides{KibanaVersion: "7.9.3"}},
+		{Name: "prod", URL: "https://kibana:5601", overrides: config.Overrides{KibanaVersion: "7.9"}},
+	}
+	for _, cmd := range tests {
+		configuration := new(ConfigurationMock)
+		context := Context{
+			Debug:         true,
+			Configuration: configuration,
+		}
+		if err := cmd.Run(&context); err == nil {
+			t.Errorf("Expected flags %+v to be reported as invalid", cmd)
+		}
+		configuration.AssertNotCalled(t, "Save")
+	}
+}
+
+func TestAddRoleConfigFromFlags(t *testing.T) {
+	configuration := new(ConfigurationMock)
+	configuration.On("AddRole", "app", config.Role{Index: "app-*", WindowFilter: "@timestamp"})
+	configuration.On("GetRole").Return("local")
+	configuration.On("Save").Return(nil)
+
 	context := Context{
-		Debug: true,
+		Debug:         true,
+		Configuration: configuration,
+	}
+	cmd := ConfigureRoleCmd{
+		Name:      "app",
+		overrides: config.Overrides{Index: "app-*"},
 	}
-	cmd := ConfigureCmd{}
 
 	err := cmd.Run(&context)
-	if err == nil {
+	if err != nil {
 		t.Fatal(err)
 	}
+	configuration.AssertExpectations(t)
+
+	missingIndex := ConfigureRoleCmd{Name: "app"}
+	if err := missingIndex.Run(&context); err == nil {
+		t.Fatal("Missing index must be reported")
+	}
+	invalidIndex := ConfigureRoleCmd{Name: "app", overrides: config.Overrides{Index: "App Logs"}}
+	if err := invalidIndex.Run(&context); err == nil {
+		t.Fatal("Invalid index must be reported")
+	}
 }
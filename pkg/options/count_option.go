@@ -0,0 +1,57 @@
+package options
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Run the count option.
+// Counts the documents matching the query within the time window without fetching them.
+// Prints the exact total, or the lower bound prefixed by '>=' when the server caps the count.
+func (c *CountCmd) Run(ctx *Context) error {
+	err := ctx.Configuration.CheckEmpty()
+	if err != nil {
+		return err
+	}
+	server, searchParams, err := c.target(ctx.Configuration)
+	if err != nil {
+		return err
+	}
+	body, err := buildBody(searchParams.countBody())
+	if err != nil {
+		return err
+	}
+	data, err := c.callApi(server, searchParams.Index, body)
+	if err != nil {
+		return err
+	}
+	err = data.failure()
+	if err != nil {
+		return err
+	}
+	total, err := data.total()
+	if err != nil {
+		return err
+	}
+	fmt.Println(total)
+	return nil
+}
+
+// total gives the total hits of the first response. Elasticsearch 7+ reports an object holding the value and
+// whether it is exact ("eq") or a lower bound ("gte"), while older versions report a plain number.
+func (r *ResponseData) total() (string, error) {
+	for _, response := range r.responses() {
+		hits, _ := response["hits"].(map[string]interface{})
+		switch total := hits["total"].(type) {
+		case json.Number:
+			return total.String(), nil
+		case map[string]interface{}:
+			if total["relation"] == "gte" {
+				return fmt.Sprintf(">=%v", total["value"]), nil
+			}
+			return fmt.Sprint(total["value"]), nil
+		}
+	}
+	return "", errors.New("unable to find the total hits in the response")
+}
@@ -0,0 +1,86 @@
+package options
+
+import (
+	"bytes"
+	"github.com/sidilabs/kishell/pkg/config"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCountWithoutFetchingDocuments(t *testing.T) {
+	configuration := new(ConfigurationMock)
+	configuration.On("CheckEmpty").Return(nil)
+	configuration.On("GetCurrentServer").Return(config.Server{Protocol: "http", Hostname: "ut.server"})
+	configuration.On("GetCurrentRole").Return(config.Role{Index: "ut-*", WindowFilter: "@timestamp"})
+
+	httpClient := new(MockHttpClient)
+	httpClient.Request = http.Request{
+		Header: map[string][]string{},
+	}
+	countPayload := mock.MatchedBy(func(body *bytes.Buffer) bool {
+		return strings.Contains(body.String(), `{"size":0,"track_total_hits":true,"query":{"bool":{"must":[{"query_string":{"query":"response:404"`)
+	})
+	httpClient.On("NewRequest", "POST", mock.Anything, countPayload).Return(&httpClient.Request, nil)
+	httpClient.On("Call", &httpClient.Request).Return(jsonResponse(`{ "responses": [ { "hits": { "total": 42, "hits": [] } } ] }`), nil)
+
+	context := Context{
+		Debug:         true,
+		Configuration: configuration,
+	}
+	cmd := CountCmd{
+		FilterFlags: FilterFlags{
+			Query:      []string{"response:404"},
+			httpClient: httpClient,
+		},
+	}
+
+	err := cmd.Run(&context)
+	if err != nil {
+		t.Fatal("Counting documents must succeed", err)
+	}
+	configuration.AssertExpectations(t)
+	httpClient.AssertExpectations(t)
+}
+
+func TestCountFailure(t *testing.T) {
+	configuration := new(ConfigurationMock)
+	configuration.On("CheckEmpty").Return(nil)
+	configuration.On("GetCurrentServer").Return(config.Server{Protocol: "http", Hostname: "ut.server"})
+	configuration.On("GetCurrentRole").Return(config.Role{Index: "ut-*", WindowFilter: "@timestamp"})
+
+	httpClient := new(MockHttpClient)
+	httpClient.Request = http.Request{
+		Header: map[string][]string{},
+	}
+	httpClient.On("NewRequest", "POST", mock.Anything, mock.Anything).Return(&httpClient.Request, nil)
+	httpClient.On("Call", &httpClient.Request).Return(jsonResponse(`{ "responses": [ { "error": { "reason": "no such index" }, "status": 404 } ] }`), nil)
+
+	context := Context{
+		Debug:         true,
+		Configuration: configuration,
+	}
+	cmd := CountCmd{
+		FilterFlags: FilterFlags{httpClient: httpClient},
+	}
+
+	err := cmd.Run(&context)
+	if err == nil || !strings.Contains(err.Error(), "no such index") {
+		t.Fatal("Counting documents must report the server error", err)
+	}
+}
+
+func TestTotalLowerBound(t *testing.T) {
+	data, err := parseResponse(jsonResponse(`{ "responses": [ { "hits": { "total": { "value": 10000, "relation": "gte" } } } ] }`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	total, err := data.total()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != ">=10000" {
+		t.Fatalf("Expected total to be a lower bound but was %s", total)
+	}
+}
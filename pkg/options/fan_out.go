@@ -0,0 +1,183 @@
+package options
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sidilabs/kishell/pkg/config"
+)
+
+const (
+	serverTagKey   = "_kishell_server"
+	roleTagKey     = "_kishell_role"
+	nameSeparator  = ","
+	unnamedDefault = "(current)"
+)
+
+// searchTarget represents one of the server and role pairs a search fans out to, or why it couldn't be resolved.
+// Empty names stand for the current server or role.
+type searchTarget struct {
+	serverName   string
+	roleName     string
+	server       config.Server
+	searchParams SearchParams
+	err          error
+}
+
+// fanOutResult represents the hits a target returned, or why it failed.
+type fanOutResult struct {
+	hits []map[string]interface{}
+	err  error
+}
+
+// splitNames splits a comma separated list of server or role names. An empty list stands for the current one.
+func splitNames(names string) []string {
+	var split []string
+	for _, name := range strings.Split(names, nameSeparator) {
+		if name = strings.TrimSpace(name); len(name) > 0 {
+			split = append(split, name)
+		}
+	}
+	if len(split) <= 0 {
+		return []string{""}
+	}
+	return split
+}
+
+// targets resolves every server and role pair given by the comma separated --server and --role lists. The index and
+// window filter overrides stand for a single role, so they are refused along a role list. A pair which can't be
+// resolved, e.g. as its server secret can't be read, keeps why for the fan-out summary rather than stopping the others.
+func (f *FilterFlags) targets(configuration config.Configuration) ([]searchTarget, error) {
+	roleNames := splitNames(f.Role)
+	if len(roleNames) > 1 && (config.OverridesRole(configuration) || len(f.WindowField) > 0) {
+		return nil, errors.New("--index, --window-filter and --window-field (or KISHELL_INDEX and " +
+			"KISHELL_WINDOW_FILTER) override a single role. Search one role at a time to use them")
+	}
+	if _, err := f.clause(); err != nil {
+		return nil, err
+	}
+	if _, err := f.OlderAsTimestamp(); err != nil {
+		return nil, err
+	}
+	if _, err := f.NewerAsTimestamp(); err != nil {
+		return nil, err
+	}
+	var targets []searchTarget
+	secrets := secretBackendOnce(configuration)
+	for _, serverName := range splitNames(f.Server) {
+		for _, roleName := range roleNames {
+			flags := *f
+			flags.Server = serverName
+			flags.Role = roleName
+			flags.secrets = secrets
+			server, searchParams, err := flags.target(configuration)
+			targets = append(targets, searchTarget{
+				serverName:   serverName,
+				roleName:     roleName,
+				server:       server,
+				searchParams: searchParams,
+				err:          err,
+			})
+		}
+	}
+	return targets, nil
+}
+
+// nameOrCurrent gives the name, or the current one's when it is empty.
+func nameOrCurrent(name string, current func() string) string {
+	if len(name) <= 0 {
+		name = current()
+	}
+	if len(name) <= 0 {
+		return unnamedDefault
+	}
+	return name
+}
+
+// fanOut searches every target concurrently, tagging each hit source with the server and role it came from, so every
+// output format can print them. Hits are merged
+// newest first by their window filter value and cut down to --limit. Failing targets don't stop the others: they are
+// summed up on stderr once the hits are printed.
+func (s *SearchCmd) fanOut(configuration config.Configuration, targets []searchTarget) error {
+	if s.Follow || s.Scroll || s.All || s.MaxDocs > 0 {
+		return errors.New("--follow, --scroll, --all and --max-docs search a single server and role at a time")
+	}
+	for i := range targets {
+		targets[i].serverName = nameOrCurrent(targets[i].serverName, configuration.GetServer)
+		targets[i].roleName = nameOrCurrent(targets[i].roleName, configuration.GetRole)
+	}
+	results := make([]fanOutResult, len(targets))
+	var group sync.WaitGroup
+	for i := range targets {
+		group.Add(1)
+		go func(i int) {
+			defer group.Done()
+			target := targets[i]
+			if target.err != nil {
+				results[i].err = target.err
+				return
+			}
+			target.searchParams.Size = s.Limit
+			data, err := s.search(target.server, target.searchParams)
+			if err != nil {
+				results[i].err = err
+				return
+			}
+			results[i].hits = data.hits()
+		}(i)
+	}
+	group.Wait()
+
+	var hits []map[string]interface{}
+	var failures []string
+	for i, result := range results {
+		if result.err != nil {
+			failures = append(failures, fmt.Sprintf("server '%s' role '%s': %s", targets[i].serverName,
+				targets[i].roleName, result.err))
+			continue
+		}
+		for _, hit := range result.hits {
+			source, ok := hit["_source"].(map[string]interface{})
+			if !ok {
+				source = map[string]interface{}{}
+				hit["_source"] = source
+			}
+			source[serverTagKey] = targets[i].serverName
+			source[roleTagKey] = targets[i].roleName
+			hits = append(hits, hit)
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		return mergeTimestamp(hits[i]) > mergeTimestamp(hits[j])
+	})
+	if s.Limit >= 0 && len(hits) > int(s.Limit) {
+		hits = hits[:s.Limit]
+	}
+	if err := printSources(s.printer, hits); err != nil {
+		return err
+	}
+	if err := s.printer.Flush(); err != nil {
+		return err
+	}
+	if len(failures) > 0 {
+		for _, failure := range failures {
+			fmt.Fprintln(os.Stderr, failure)
+		}
+		return fmt.Errorf("%d of %d searches failed", len(failures), len(targets))
+	}
+	return nil
+}
+
+// mergeTimestamp gives the window filter value of the hit, placing hits without one last.
+func mergeTimestamp(hit map[string]interface{}) int64 {
+	timestamp, err := sortTimestamp(hit)
+	if err != nil {
+		return math.MinInt64
+	}
+	return timestamp
+}
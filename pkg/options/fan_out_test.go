@@ -0,0 +1,209 @@
+package options
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/go-http-utils/headers"
+	"github.com/sidilabs/kishell/pkg/config"
+	"github.com/sidilabs/kishell/pkg/output"
+	"github.com/sidilabs/kishell/pkg/utils"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newSearchServer stands for an Elasticsearch server answering every search with the hits, or with the status code
+// when it is an error.
+func newSearchServer(status int, hits string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headers.ContentType, jsonContentType)
+		w.WriteHeader(status)
+		w.Write([]byte(`{"hits":{"hits":[` + hits + `]}}`))
+	}))
+}
+
+func TestSplitNames(t *testing.T) {
+	if names := splitNames("us, eu,,ap"); strings.Join(names, "|") != "us|eu|ap" {
+		t.Errorf("Unexpected names %v", names)
+	}
+	if names := splitNames(""); len(names) != 1 || names[0] != "" {
+		t.Errorf("An empty list must stand for the current name, got %v", names)
+	}
+}
+
+func TestFanOutMergesByWindowFilter(t *testing.T) {
+	us := newSearchServer(http.StatusOK, `{"_source":{"id":"us-1"},"sort":[3000]},{"_source":{"id":"us-2"},"sort":[1000]}`)
+	defer us.Close()
+	eu := newSearchServer(http.StatusOK, `{"_source":{"id":"eu-1"},"sort":[2000]}`)
+	defer eu.Close()
+	ap := newSearchServer(http.StatusInternalServerError, ``)
+	defer ap.Close()
+
+	configuration := new(ConfigurationMock)
+	configuration.On("GetCurrentServer").Return(config.Server{})
+	configuration.On("GetCurrentRole").Return(config.Role{Index: "logs-*", WindowFilter: "@timestamp"})
+	configuration.On("GetRole").Return("logs")
+	for name, testServer := range map[string]*httptest.Server{"us": us, "eu": eu, "ap": ap} {
+		server := pingServer(t, testServer, "7.10.2")
+		server.Type = config.ElasticsearchServer
+		server.ElasticsearchVersion = "7.10.2"
+		configuration.On("FindServer", name).Return(server, true)
+	}
+
+	var out bytes.Buffer
+	printer, err := output.New(output.JSONFormat, nil, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := SearchCmd{
+		FilterFlags: FilterFlags{
+			Older:      "now",
+			Newer:      "15m",
+			Server:     "us,eu,ap",
+			httpClient: &utils.DefaultHTTPClient{Timeout: 5 * time.Second},
+		},
+		Limit:   2,
+		printer: printer,
+	}
+	targets, err := cmd.targets(configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cmd.fanOut(configuration, targets)
+	if err == nil || err.Error() != "1 of 3 searches failed" {
+		t.Fatal("Failing servers must be summed up without aborting the others", err)
+	}
+
+	var ids []string
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var hit map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &hit); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, hit["id"].(string)+"@"+hit[serverTagKey].(string)+"/"+hit[roleTagKey].(string))
+	}
+	if strings.Join(ids, " ") != "us-1@us/logs eu-1@eu/logs" {
+		t.Errorf("Hits must be merged newest first, tagged and cut down to the limit, got %v", ids)
+	}
+}
+
+func TestFanOutKeepsSearchingPastUnresolvedServers(t *testing.T) {
+	us := newSearchServer(http.StatusOK, `{"_source":{"id":"us-1"},"sort":[3000]}`)
+	defer us.Close()
+
+	configuration := new(ConfigurationMock)
+	configuration.On("GetCurrentServer").Return(config.Server{})
+	configuration.On("GetCurrentRole").Return(config.Role{Index: "logs-*", WindowFilter: "@timestamp"})
+	configuration.On("GetRole").Return("logs")
+	configuration.On("GetStdin").Return(&bytes.Buffer{})
+	configuration.On("GetSecretBackend", mock.Anything).Return(nil, errors.New("vault passphrase is wrong"))
+	server := pingServer(t, us, "7.10.2")
+	server.Type = config.ElasticsearchServer
+	server.ElasticsearchVersion = "7.10.2"
+	configuration.On("FindServer", "us").Return(server, true)
+	server.AuthType = config.APIKeyAuth
+	server.Secret = "eu-secret"
+	configuration.On("FindServer", "eu").Return(server, true)
+
+	var out bytes.Buffer
+	printer, err := output.New(output.JSONFormat, nil, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := SearchCmd{
+		FilterFlags: FilterFlags{
+			Older:      "now",
+			Newer:      "15m",
+			Server:     "us,eu",
+			httpClient: &utils.DefaultHTTPClient{Timeout: 5 * time.Second},
+		},
+		Limit:   10,
+		printer: printer,
+	}
+	targets, err := cmd.targets(configuration)
+	if err != nil {
+		t.Fatal("Servers failing to resolve must not abort the fan-out", err)
+	}
+	err = cmd.fanOut(configuration, targets)
+	if err == nil || err.Error() != "1 of 2 searches failed" {
+		t.Fatal("Servers failing to resolve must be summed up with the others", err)
+	}
+	if !strings.Contains(out.String(), `"id":"us-1"`) {
+		t.Errorf("Resolved servers must still be searched, got %s", out.String())
+	}
+}
+
+func TestFanOutSingleTargetModesOnly(t *testing.T) {
+	cmd := SearchCmd{Follow: true}
+	err := cmd.fanOut(new(ConfigurationMock), []searchTarget{{}, {}})
+	if err == nil {
+		t.Fatal("Following must be refused across several servers")
+	}
+}
+
+func TestTargetsAskPassphraseOnce(t *testing.T) {
+	server := config.Server{Protocol: "http", Hostname: "ut.server", AuthType: config.APIKeyAuth, Secret: "ut-secret"}
+	configuration := new(ConfigurationMock)
+	configuration.On("FindServer", "us").Return(server, true)
+	configuration.On("FindServer", "eu").Return(server, true)
+	configuration.On("GetCurrentServer").Return(config.Server{})
+	configuration.On("GetCurrentRole").Return(config.Role{Index: "ut-*", WindowFilter: "@timestamp"})
+	configuration.On("GetStdin").Return(&bytes.Buffer{})
+	configuration.On("GetSecretBackend", mock.Anything).Return(memorySecrets{"ut-secret": "aWQ6a2V5"}, nil)
+
+	filterFlags := FilterFlags{Older: "now", Newer: "15m", Server: "us,eu"}
+	targets, err := filterFlags.targets(configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 2 {
+		t.Fatalf("Expected a target per server, got %d", len(targets))
+	}
+	configuration.AssertNumberOfCalls(t, "GetSecretBackend", 1)
+}
+
+func TestRoleListRejectsRoleOverrides(t *testing.T) {
+	stored := new(ConfigurationMock)
+	stored.On("FindRole", mock.Anything).Return(config.Role{Index: "ut-*", WindowFilter: "@timestamp"}, true)
+	stored.On("GetCurrentRole").Return(config.Role{Index: "ut-*", WindowFilter: "@timestamp"})
+	stored.On("GetCurrentServer").Return(config.Server{Protocol: "http", Hostname: "ut.server"})
+	configuration, err := config.WithOverrides(stored, config.Overrides{Index: "audit-*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filterFlags := FilterFlags{Older: "now", Newer: "15m", Role: "web,db"}
+	if _, err := filterFlags.targets(configuration); err == nil {
+		t.Fatal("--index must be refused along a role list")
+	}
+	filterFlags = FilterFlags{Older: "now", Newer: "15m", Role: "web,db", WindowField: "event.created"}
+	if _, err := filterFlags.targets(stored); err == nil {
+		t.Fatal("--window-field must be refused along a role list")
+	}
+	filterFlags = FilterFlags{Older: "now", Newer: "15m", Role: "web"}
+	targets, err := filterFlags.targets(configuration)
+	if err != nil || len(targets) != 1 || targets[0].searchParams.Index != "audit-*" {
+		t.Fatal("--index must still override a single role", err)
+	}
+}
+
+func TestSingleTargetCommandsRejectLists(t *testing.T) {
+	configuration := new(ConfigurationMock)
+	configuration.On("CheckEmpty").Return(nil)
+
+	cmd := CountCmd{FilterFlags: FilterFlags{Older: "now", Newer: "15m", Server: "us,eu"}}
+	err := cmd.Run(&Context{Configuration: configuration})
+	if err == nil || !strings.Contains(err.Error(), "Only search accepts a comma separated list") {
+		t.Fatal("Server lists must be rejected clearly outside of search", err)
+	}
+	cmd = CountCmd{FilterFlags: FilterFlags{Older: "now", Newer: "15m", Role: "web,db"}}
+	configuration.On("GetCurrentServer").Return(config.Server{Protocol: "http", Hostname: "ut.server"})
+	err = cmd.Run(&Context{Configuration: configuration})
+	if err == nil || !strings.Contains(err.Error(), "Only search accepts a comma separated list") {
+		t.Fatal("Role lists must be rejected clearly outside of search", err)
+	}
+}
@@ -0,0 +1,148 @@
+package options
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/sidilabs/kishell/pkg/output"
+)
+
+const (
+	histogramAggregation = "2"
+	histogramBuckets     = 60
+)
+
+var (
+	intervalPattern = regexp.MustCompile(`^\d+(ms|s|m|h|d|w|M|q|y)$`)
+	// niceIntervals are the intervals picked from when the user does not provide one, from the smallest up.
+	niceIntervals = []struct {
+		duration time.Duration
+		name     string
+	}{
+		{time.Second, "1s"},
+		{5 * time.Second, "5s"},
+		{10 * time.Second, "10s"},
+		{30 * time.Second, "30s"},
+		{time.Minute, "1m"},
+		{5 * time.Minute, "5m"},
+		{10 * time.Minute, "10m"},
+		{30 * time.Minute, "30m"},
+		{time.Hour, "1h"},
+		{3 * time.Hour, "3h"},
+		{12 * time.Hour, "12h"},
+		{24 * time.Hour, "1d"},
+		{7 * 24 * time.Hour, "7d"},
+		{30 * 24 * time.Hour, "30d"},
+	}
+)
+
+// histogramBody gives the search request counting documents per interval over the whole time window, empty
+// intervals included.
+func histogramBody(searchParams SearchParams) searchRequest {
+	histogram := searchParams.dateHistogram(0)
+	histogram.ExtendedBounds = &extendedBounds{Min: searchParams.Newer, Max: searchParams.Older}
+	return searchRequest{
+		Aggs:  map[string]aggregation{histogramAggregation: {DateHistogram: histogram}},
+		Query: searchParams.query(),
+	}
+}
+
+// Run the histogram option.
+// Counts documents matching the query per time interval within the time window.
+// Prints the buckets as a bar chart, a sparkline or as CSV.
+func (h *HistogramCmd) Run(ctx *Context) error {
+	err := ctx.Configuration.CheckEmpty()
+	if err != nil {
+		return err
+	}
+	server, searchParams, err := h.target(ctx.Configuration)
+	if err != nil {
+		return err
+	}
+	searchParams.Interval, err = h.interval(searchParams)
+	if err != nil {
+		return err
+	}
+	searchParams.IntervalKey = intervalKey(server, searchParams.Interval)
+	body, err := buildBody(histogramBody(searchParams))
+	if err != nil {
+		return err
+	}
+	data, err := h.callApi(server, searchParams.Index, body)
+	if err != nil {
+		return err
+	}
+	err = data.failure()
+	if err != nil {
+		return err
+	}
+	buckets, err := data.buckets(histogramAggregation)
+	if err != nil {
+		return err
+	}
+	switch h.Format {
+	case "csv":
+		return output.PrintBucketsCSV(os.Stdout, buckets)
+	case "sparkline":
+		return output.PrintSparkline(os.Stdout, buckets)
+	}
+	return output.PrintBars(os.Stdout, buckets, output.TerminalWidth(os.Stdout))
+}
+
+// interval gives the interval requested by the user or picks one splitting the time window in about 60 buckets.
+func (h *HistogramCmd) interval(searchParams SearchParams) (string, error) {
+	if len(h.Interval) > 0 {
+		if !intervalPattern.MatchString(h.Interval) {
+			return "", fmt.Errorf("interval '%s' is invalid. Expected an amount followed by a time unit, e.g. 30s, 5m, 1h or 1d", h.Interval)
+		}
+		return h.Interval, nil
+	}
+	window := time.Duration(searchParams.Older-searchParams.Newer) * time.Millisecond
+	for _, interval := range niceIntervals {
+		if interval.duration*histogramBuckets >= window {
+			return interval.name, nil
+		}
+	}
+	return niceIntervals[len(niceIntervals)-1].name, nil
+}
+
+// buckets gives the buckets of the date histogram aggregation found in the first response.
+func (r *ResponseData) buckets(aggregation string) ([]output.Bucket, error) {
+	for _, response := range r.responses() {
+		aggregations, _ := response["aggregations"].(map[string]interface{})
+		histogram, ok := aggregations[aggregation].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		items, _ := histogram["buckets"].([]interface{})
+		buckets := make([]output.Bucket, 0, len(items))
+		for _, item := range items {
+			bucket, _ := item.(map[string]interface{})
+			key, err := toInt64(bucket["key"])
+			if err != nil {
+				return nil, err
+			}
+			count, err := toInt64(bucket["doc_count"])
+			if err != nil {
+				return nil, err
+			}
+			buckets = append(buckets, output.Bucket{
+				Key:   time.Unix(0, key*int64(time.Millisecond)),
+				Count: count,
+			})
+		}
+		return buckets, nil
+	}
+	return nil, errors.New("unable to find the histogram in the response")
+}
+
+func toInt64(value interface{}) (int64, error) {
+	if number, ok := value.(json.Number); ok {
+		return number.Int64()
+	}
+	return 0, fmt.Errorf("'%v' is not a number", value)
+}
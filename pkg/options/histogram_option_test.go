@@ -0,0 +1,103 @@
+package options
+
+import (
+	"bytes"
+	"github.com/sidilabs/kishell/pkg/config"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHistogramWithInterval(t *testing.T) {
+	configuration := new(ConfigurationMock)
+	configuration.On("CheckEmpty").Return(nil)
+	configuration.On("GetCurrentServer").Return(config.Server{Protocol: "http", Hostname: "ut.server"})
+	configuration.On("GetCurrentRole").Return(config.Role{Index: "ut-*", WindowFilter: "@timestamp"})
+
+	httpClient := new(MockHttpClient)
+	httpClient.Request = http.Request{
+		Header: map[string][]string{},
+	}
+	histogramPayload := mock.MatchedBy(func(body *bytes.Buffer) bool {
+		return strings.Contains(body.String(), `"date_histogram":{"field":"@timestamp","interval":"5m",`)
+	})
+	httpClient.On("NewRequest", "POST", mock.Anything, histogramPayload).Return(&httpClient.Request, nil)
+	httpClient.On("Call", &httpClient.Request).Return(jsonResponse(`{ "responses": [ { "aggregations": { "2": { "buckets": [
+		{ "key": 1609459200000, "doc_count": 3 }, { "key": 1609459500000, "doc_count": 0 } ] } } } ] }`), nil)
+
+	context := Context{
+		Debug:         true,
+		Configuration: configuration,
+	}
+	cmd := HistogramCmd{
+		FilterFlags: FilterFlags{httpClient: httpClient},
+		Interval:    "5m",
+		Format:      "csv",
+	}
+
+	err := cmd.Run(&context)
+	if err != nil {
+		t.Fatal("Building the histogram must succeed", err)
+	}
+	httpClient.AssertExpectations(t)
+}
+
+func TestHistogramDetectsElasticsearchVersion(t *testing.T) {
+	configuration := new(ConfigurationMock)
+	configuration.On("CheckEmpty").Return(nil)
+	configuration.On("GetCurrentServer").Return(config.Server{Type: config.ElasticsearchServer, Protocol: "http",
+		Hostname: "es.ut"})
+	configuration.On("GetCurrentRole").Return(config.Role{Index: "ut-*", WindowFilter: "@timestamp"})
+
+	httpClient := new(MockHttpClient)
+	httpClient.Request = http.Request{
+		Header: map[string][]string{},
+	}
+	histogramPayload := mock.MatchedBy(func(body *bytes.Buffer) bool {
+		return strings.Contains(body.String(), `"date_histogram":{"field":"@timestamp","fixed_interval":"5m",`)
+	})
+	httpClient.On("NewRequest", "GET", "http://es.ut:9200/", mock.Anything).Return(&httpClient.Request, nil).Once()
+	httpClient.On("Call", &httpClient.Request).Return(jsonResponse(`{ "version": { "number": "8.11.1" } }`), nil).Once()
+	httpClient.On("NewRequest", "POST", mock.Anything, histogramPayload).Return(&httpClient.Request, nil).Once()
+	httpClient.On("Call", &httpClient.Request).Return(jsonResponse(`{ "aggregations": { "2": { "buckets": [
+		{ "key": 1609459200000, "doc_count": 3 } ] } } }`), nil).Once()
+
+	cmd := HistogramCmd{
+		FilterFlags: FilterFlags{httpClient: httpClient},
+		Interval:    "5m",
+		Format:      "csv",
+	}
+	err := cmd.Run(&Context{Configuration: configuration})
+	if err != nil {
+		t.Fatal("Elasticsearch servers without a version must be asked for it", err)
+	}
+	httpClient.AssertExpectations(t)
+}
+
+func TestHistogramIntervalFromWindow(t *testing.T) {
+	cmd := HistogramCmd{}
+	tests := map[int64]string{
+		15 * 60 * 1000:            "30s",
+		60 * 60 * 1000:            "1m",
+		24 * 60 * 60 * 1000:       "30m",
+		365 * 24 * 60 * 60 * 1000: "7d",
+	}
+	for window, expected := range tests {
+		interval, err := cmd.interval(SearchParams{Newer: 0, Older: window})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if interval != expected {
+			t.Errorf("Expected interval for a %dms window to be %s but was %s", window, expected, interval)
+		}
+	}
+}
+
+func TestHistogramInvalidInterval(t *testing.T) {
+	cmd := HistogramCmd{Interval: "5 minutes"}
+	_, err := cmd.interval(SearchParams{})
+	if err == nil {
+		t.Fatal("Invalid intervals must be rejected")
+	}
+}
@@ -1,6 +1,7 @@
 package options
 
 import (
+	"github.com/sidilabs/kishell/pkg/utils"
 	"github.com/stretchr/testify/mock"
 	"io"
 	"net/http"
@@ -22,3 +23,7 @@ func (c *MockHttpClient) NewRequest(method, url string, body io.Reader) (*http.R
 	args := c.Called(method, url, body)
 	return args.Get(0).(*http.Request), args.Error(1)
 }
+
+func (c *MockHttpClient) WithTLS(settings utils.TLSSettings) (utils.HTTPClient, error) {
+	return c, nil
+}
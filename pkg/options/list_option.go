@@ -1,7 +1,26 @@
 package options
 
+import (
+	"fmt"
+)
+
+const precedenceNote = `Settings are resolved with the following precedence: flags > environment variables > config file.
+  --config, KISHELL_CONFIG                       config file path (~/.kishell by default)
+  --server-url, KISHELL_SERVER_URL               server URL, e.g. https://kibana.example.com:5601
+  --server-type, KISHELL_SERVER_TYPE             server type, either kibana or elasticsearch
+  --kibana-version, KISHELL_KIBANA_VERSION       Kibana version
+  --es-version, KISHELL_ES_VERSION               Elasticsearch version of elasticsearch servers
+  --username, KISHELL_USERNAME                   username for basic authentication
+  --password, KISHELL_PASSWORD                   password for basic authentication
+  --index, KISHELL_INDEX                         index pattern to search
+  --window-filter, KISHELL_WINDOW_FILTER         field the time window is filtered by`
+
 // Run the list option.
-// Lists the whole config file in a pretty printed style.
+// Lists the whole config file in a pretty printed style, followed by the overrides and how they take precedence.
 func (l *ListCmd) Run(ctx *Context) error {
-	return ctx.Configuration.PrettyPrint()
+	if err := ctx.Configuration.PrettyPrint(); err != nil {
+		return err
+	}
+	fmt.Println(precedenceNote)
+	return nil
 }
@@ -0,0 +1,201 @@
+package options
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/sidilabs/kishell/pkg/config"
+)
+
+// msearchQuery represents one of the queries batched in the multi-search request, as given by a line of --file. The
+// query DSL clause, when given, is used instead of the query.
+type msearchQuery struct {
+	Label string          `json:"label"`
+	Query string          `json:"query"`
+	DSL   json.RawMessage `json:"dsl"`
+	Index string          `json:"index"`
+}
+
+// msearchResult represents what is printed for each query: the total and the sources of the hits fetched, or why
+// the query failed.
+type msearchResult struct {
+	Label string        `json:"label"`
+	Index string        `json:"index"`
+	Total string        `json:"total,omitempty"`
+	Hits  []interface{} `json:"hits,omitempty"`
+	Error string        `json:"error,omitempty"`
+}
+
+// Run the msearch option.
+// Packs every query into a single multi-search request, sharing the time window, server and role.
+// Prints a JSON line per query holding its label, total and hits, in the order the queries were given.
+func (m *MsearchCmd) Run(ctx *Context) error {
+	err := ctx.Configuration.CheckEmpty()
+	if err != nil {
+		return err
+	}
+	queries, err := m.queries()
+	if err != nil {
+		return err
+	}
+	if len(queries) <= 0 {
+		return errors.New("no query to run. Use --query, --dsl, --dsl-file or --file")
+	}
+	// The queries are batched in the payload, the filter flags only pick the target and time window.
+	filterFlags := m.FilterFlags
+	filterFlags.Query, filterFlags.DSL, filterFlags.DSLFile = nil, "", ""
+	server, searchParams, err := filterFlags.target(ctx.Configuration)
+	if err != nil {
+		return err
+	}
+	payload, err := m.payload(queries, searchParams)
+	if err != nil {
+		return err
+	}
+	httpClient, err := serverHTTPClient(server, m.httpClient)
+	if err != nil {
+		return err
+	}
+	data, err := newTransport(server, httpClient).msearch(payload)
+	if err != nil {
+		return err
+	}
+	responses := data.responses()
+	if len(responses) != len(queries) {
+		return fmt.Errorf("expected %d responses to the multi-search request but got %d", len(queries),
+			len(responses))
+	}
+	var failed int
+	for i, response := range responses {
+		result := label(queries[i], &ResponseData{Payload: response})
+		if len(result.Error) > 0 {
+			failed++
+		}
+		asJSON, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(asJSON))
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d queries failed", failed, len(queries))
+	}
+	return nil
+}
+
+// queries lists the queries given by each --query, or by --dsl or --dsl-file, followed by the ones in --file. Empty
+// lines are skipped.
+func (m *MsearchCmd) queries() ([]msearchQuery, error) {
+	var queries []msearchQuery
+	for _, query := range m.Query {
+		queries = append(queries, msearchQuery{Query: query})
+	}
+	if len(m.DSL) > 0 {
+		queries = append(queries, msearchQuery{DSL: json.RawMessage(m.DSL)})
+	}
+	if len(m.DSLFile) > 0 {
+		content, err := ioutil.ReadFile(m.DSLFile)
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, msearchQuery{DSL: content})
+	}
+	if len(m.File) <= 0 {
+		return queries, nil
+	}
+	file, err := os.Open(m.File)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) <= 0 {
+			continue
+		}
+		var query msearchQuery
+		if err := json.Unmarshal(scanner.Bytes(), &query); err != nil {
+			return nil, fmt.Errorf("line %d of '%s' is invalid: %s", line, m.File, err)
+		}
+		queries = append(queries, query)
+	}
+	return queries, scanner.Err()
+}
+
+// payload builds the multi-search body: a header line naming the index and a body line per query. Queries without
+// an index search the role one. Totals are tracked past 10,000 hits, as count does.
+func (m *MsearchCmd) payload(queries []msearchQuery, searchParams SearchParams) (bytes.Buffer, error) {
+	var payload bytes.Buffer
+	for i := range queries {
+		params := searchParams
+		params.Size = m.Limit
+		if len(queries[i].Index) > 0 {
+			if err := config.ValidateIndexPattern(queries[i].Index); err != nil {
+				return bytes.Buffer{}, err
+			}
+			params.Index = queries[i].Index
+		}
+		queries[i].Index = params.Index
+		clause, err := queries[i].clause()
+		if err != nil {
+			return bytes.Buffer{}, err
+		}
+		params.Clause = clause
+		header, err := buildBody(newMsearchHeader(params.Index))
+		if err != nil {
+			return bytes.Buffer{}, err
+		}
+		request := params.searchBody()
+		request.TrackTotalHits = true
+		body, err := buildBody(request)
+		if err != nil {
+			return bytes.Buffer{}, err
+		}
+		payload.Write(header.Bytes())
+		payload.WriteString(lineBreak)
+		payload.Write(body.Bytes())
+		payload.WriteString(lineBreak)
+	}
+	return payload, nil
+}
+
+// clause gives the query clause out of the query DSL, or matching the query, or every document when there is none.
+func (q *msearchQuery) clause() (string, error) {
+	if len(q.DSL) > 0 {
+		return dslClause(q.DSL)
+	}
+	if len(q.Query) <= 0 {
+		return matchAllClause, nil
+	}
+	return queryStringClause(q.Query)
+}
+
+// label gives the result of the query out of its sub-response. Queries without a label are labeled by the query
+// text or DSL, or by the index when they match every document.
+func label(query msearchQuery, data *ResponseData) msearchResult {
+	result := msearchResult{Label: query.Label, Index: query.Index}
+	if len(result.Label) <= 0 {
+		result.Label = query.Query
+	}
+	if len(result.Label) <= 0 {
+		result.Label = string(query.DSL)
+	}
+	if len(result.Label) <= 0 {
+		result.Label = query.Index
+	}
+	if err := data.failure(); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Total, _ = data.total()
+	for _, hit := range data.hits() {
+		result.Hits = append(result.Hits, hit["_source"])
+	}
+	return result
+}
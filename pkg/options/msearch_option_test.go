@@ -0,0 +1,143 @@
+package options
+
+import (
+	"bytes"
+	"github.com/alecthomas/kong"
+	"github.com/sidilabs/kishell/pkg/config"
+	"github.com/sidilabs/kishell/pkg/utils"
+	"github.com/stretchr/testify/mock"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMsearchBatchesQueries(t *testing.T) {
+	configuration := new(ConfigurationMock)
+	configuration.On("CheckEmpty").Return(nil)
+	configuration.On("GetCurrentServer").Return(config.Server{Type: config.ElasticsearchServer, Protocol: "http", Hostname: "es.ut",
+		ElasticsearchVersion: "8.11.1"})
+	configuration.On("GetCurrentRole").Return(config.Role{Index: "ut-*", WindowFilter: "@timestamp"})
+
+	httpClient := new(MockHttpClient)
+	httpClient.Request = http.Request{
+		Header: map[string][]string{},
+	}
+	msearchPayload := mock.MatchedBy(func(body *bytes.Buffer) bool {
+		lines := strings.Split(strings.TrimSpace(body.String()), "\n")
+		return len(lines) == 6 &&
+			strings.HasPrefix(lines[0], `{"index":"ut-*"`) &&
+			strings.Contains(lines[1], `"query":"response:404"`) &&
+			strings.Contains(lines[1], `"track_total_hits":true`) &&
+			strings.HasPrefix(lines[2], `{"index":"ut-*"`) &&
+			strings.Contains(lines[3], `{"term":{"response":403}}`) &&
+			strings.Contains(lines[3], `"track_total_hits":true`) &&
+			strings.HasPrefix(lines[4], `{"index":"audit-*"`) &&
+			strings.Contains(lines[5], `"query":"response:500"`)
+	})
+	httpClient.On("NewRequest", "POST", "http://es.ut:9200/_msearch", msearchPayload).Return(&httpClient.Request, nil)
+	httpClient.On("Call", &httpClient.Request).Return(jsonResponse(`{ "responses": [
+		{ "hits": { "total": { "value": 3, "relation": "eq" }, "hits": [ { "_source": { "response": 404 } } ] } },
+		{ "hits": { "total": { "value": 12000, "relation": "eq" }, "hits": [ { "_source": { "response": 403 } } ] } },
+		{ "error": { "reason": "no such index" }, "status": 404 } ] }`), nil)
+
+	file, err := ioutil.TempFile("", "kishell-msearch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString(`{"label":"server errors","query":"response:500","index":"audit-*"}` + "\n\n")
+	file.Close()
+
+	cmd := MsearchCmd{
+		FilterFlags: FilterFlags{
+			Query:      []string{"response:404"},
+			DSL:        `{"term":{"response":403}}`,
+			Older:      "now",
+			Newer:      "15m",
+			httpClient: httpClient,
+		},
+		File:  file.Name(),
+		Limit: 1,
+	}
+	err = cmd.Run(&Context{Configuration: configuration})
+	if err == nil || err.Error() != "1 of 3 queries failed" {
+		t.Fatal("Failing queries must be reported once every result is printed", err)
+	}
+	httpClient.AssertExpectations(t)
+}
+
+func TestMsearchRepeatedQuery(t *testing.T) {
+	parser, err := kong.New(&CLI, kong.Bind(&utils.DefaultHTTPClient{}, &CLI.OverrideFlags))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = parser.Parse([]string{"msearch", "--query=response:404", "--query=response:500"})
+	if err != nil {
+		t.Fatal("Msearch must accept --query more than once", err)
+	}
+
+	configuration := new(ConfigurationMock)
+	configuration.On("CheckEmpty").Return(nil)
+	configuration.On("GetCurrentServer").Return(config.Server{Type: config.ElasticsearchServer, Protocol: "http", Hostname: "es.ut",
+		ElasticsearchVersion: "8.11.1"})
+	configuration.On("GetCurrentRole").Return(config.Role{Index: "ut-*", WindowFilter: "@timestamp"})
+
+	httpClient := new(MockHttpClient)
+	httpClient.Request = http.Request{
+		Header: map[string][]string{},
+	}
+	msearchPayload := mock.MatchedBy(func(body *bytes.Buffer) bool {
+		lines := strings.Split(strings.TrimSpace(body.String()), "\n")
+		return len(lines) == 4 &&
+			strings.Contains(lines[1], `"query":"response:404"`) &&
+			strings.Contains(lines[3], `"query":"response:500"`)
+	})
+	httpClient.On("NewRequest", "POST", "http://es.ut:9200/_msearch", msearchPayload).Return(&httpClient.Request, nil)
+	httpClient.On("Call", &httpClient.Request).Return(jsonResponse(`{ "responses": [
+		{ "hits": { "total": { "value": 3, "relation": "eq" }, "hits": [] } },
+		{ "hits": { "total": { "value": 1, "relation": "eq" }, "hits": [] } } ] }`), nil)
+
+	cmd := CLI.Msearch
+	cmd.httpClient = httpClient
+	if err := cmd.Run(&Context{Configuration: configuration}); err != nil {
+		t.Fatal(err)
+	}
+	httpClient.AssertExpectations(t)
+}
+
+func TestSearchRejectsRepeatedQuery(t *testing.T) {
+	filterFlags := FilterFlags{Query: []string{"response:404", "response:500"}}
+	if _, err := filterFlags.clause(); err == nil {
+		t.Fatal("Only msearch must accept --query more than once")
+	}
+}
+
+func TestMsearchWithoutQueries(t *testing.T) {
+	configuration := new(ConfigurationMock)
+	configuration.On("CheckEmpty").Return(nil)
+
+	cmd := MsearchCmd{}
+	if err := cmd.Run(&Context{Configuration: configuration}); err == nil {
+		t.Fatal("Running no query must be refused")
+	}
+}
+
+func TestMsearchLabels(t *testing.T) {
+	data := &ResponseData{Payload: map[string]interface{}{
+		"hits": map[string]interface{}{"total": map[string]interface{}{"value": 10000, "relation": "gte"}},
+	}}
+	result := label(msearchQuery{Index: "ut-*"}, data)
+	if result.Label != "ut-*" || result.Total != ">=10000" || len(result.Hits) != 0 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	result = label(msearchQuery{Query: "response:404", Index: "ut-*"}, data)
+	if result.Label != "response:404" {
+		t.Errorf("Queries without a label must be labeled by the query text, got %+v", result)
+	}
+	result = label(msearchQuery{DSL: []byte(`{"term":{"response":404}}`), Index: "ut-*"}, data)
+	if result.Label != `{"term":{"response":404}}` {
+		t.Errorf("Queries without a label must be labeled by their DSL, got %+v", result)
+	}
+}
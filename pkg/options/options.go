@@ -1,10 +1,14 @@
 package options
 
 import (
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/alecthomas/kong"
 	"github.com/sidilabs/kishell/pkg/config"
+	"github.com/sidilabs/kishell/pkg/output"
 	"github.com/sidilabs/kishell/pkg/utils"
 )
 
@@ -22,9 +26,67 @@ type Option struct {
 
 // ConfigureCmd represents CLI arguments for configure option.
 type ConfigureCmd struct {
-	Server bool `optional help:"Add a new server definition"`
-	Role   bool `optional help:"Add a new role definition"`
-	Reset  bool `optional help:"Reset the whole configuration"`
+	Server  ConfigureServerCmd  `cmd help:"Add a new server definition. Prompts for each field unless --name is given"`
+	Role    ConfigureRoleCmd    `cmd help:"Add a new role definition. Prompts for each field unless --name is given"`
+	Edit    ConfigureEditCmd    `cmd help:"Edit a server or role definition, prompting with the current values as defaults"`
+	Rename  ConfigureRenameCmd  `cmd help:"Rename a server or role definition"`
+	Remove  ConfigureRemoveCmd  `cmd help:"Remove a server or role definition"`
+	Secrets ConfigureSecretsCmd `cmd help:"Choose where server credentials are stored"`
+	Reset   ConfigureResetCmd   `cmd help:"Reset the whole configuration"`
+}
+
+// ConfigureServerCmd represents CLI arguments for configure server option. The password and Kibana version are given
+// through the global --password and --kibana-version flags.
+type ConfigureServerCmd struct {
+	Name               string           `optional help:"Server name. Fields are taken from flags instead of prompts when given"`
+	URL                string           `optional name:"url" help:"Server URL, e.g. https://kibana.example.com:5601. Defaults to --server-url"`
+	Type               string           `optional help:"Server type, either kibana or elasticsearch. Defaults to --server-type, or kibana"`
+	User               string           `optional help:"Username for basic authentication. Defaults to --username"`
+	AuthType           string           `optional name:"auth-type" help:"Authentication type, either basic, apikey or bearer. Defaults to basic"`
+	Token              string           `optional help:"Encoded API key or bearer token, depending on --auth-type"`
+	Secret             string           `optional help:"Secret name to store credentials in, instead of the config file"`
+	CAFile             string           `optional name:"ca-file" help:"CA bundle to trust besides the system certificates"`
+	ClientCert         string           `optional name:"client-cert" help:"Client certificate for mutual TLS"`
+	ClientKey          string           `optional name:"client-key" help:"Client key for mutual TLS"`
+	InsecureSkipVerify bool             `optional name:"insecure-skip-verify" help:"Skip the server certificate verification"`
+	Default            bool             `optional help:"Set as default server"`
+	overrides          config.Overrides `-`
+}
+
+// ConfigureRoleCmd represents CLI arguments for configure role option. The index pattern and window filter are given
+// through the global --index and --window-filter flags.
+type ConfigureRoleCmd struct {
+	Name      string           `optional help:"Role name. Fields are taken from flags instead of prompts when given"`
+	Default   bool             `optional help:"Set as default role"`
+	overrides config.Overrides `-`
+}
+
+// ConfigureEditCmd represents CLI arguments for configure edit option.
+type ConfigureEditCmd struct {
+	Server string `optional help:"Server to edit"`
+	Role   string `optional help:"Role to edit"`
+}
+
+// ConfigureRenameCmd represents CLI arguments for configure rename option.
+type ConfigureRenameCmd struct {
+	Server string `optional help:"Server to rename"`
+	Role   string `optional help:"Role to rename"`
+	To     string `required help:"New name"`
+}
+
+// ConfigureRemoveCmd represents CLI arguments for configure remove option.
+type ConfigureRemoveCmd struct {
+	Server  string `optional help:"Server to remove"`
+	Role    string `optional help:"Role to remove"`
+	Default string `optional help:"New default server or role when removing the current default one. Prompted for when missing"`
+}
+
+// ConfigureSecretsCmd represents CLI arguments for configure secrets option.
+type ConfigureSecretsCmd struct {
+}
+
+// ConfigureResetCmd represents CLI arguments for configure reset option.
+type ConfigureResetCmd struct {
 }
 
 // UseCmd represents CLI arguments for use option.
@@ -37,33 +99,120 @@ type UseCmd struct {
 type ListCmd struct {
 }
 
+// FilterFlags represents CLI arguments shared by options filtering documents by query and time window.
+type FilterFlags struct {
+	Query       []string         `optional xor:"query" sep:"none" help:"Text input to query data. Use the same format as you would use in Kibana. Only msearch accepts it more than once"`
+	DSL         string           `optional name:"dsl" xor:"query" help:"Query DSL clause as JSON, e.g. '{\"terms\":{\"response\":[404,500]}}'. Used instead of --query, still filtered by the time window"`
+	DSLFile     string           `optional name:"dsl-file" xor:"query" type:"existingfile" help:"File holding the query DSL clause as JSON. Used instead of --query, still filtered by the time window"`
+	Older       string           `optional default:"now" help:"Data older than. Defaults to current time when not provided. Accepts a duration relative to now (valid time units are 'ns', 'us' (or 'µs'), 'ms', 's', 'm', 'h', 'd', 'w'), a RFC 3339 timestamp, epoch millis or date math like 'now-1d/d'."`
+	Newer       string           `optional default:"15m" help:"Data newer than. Defaults to 15m when not provided. Accepts a duration relative to now (valid time units are 'ns', 'us' (or 'µs'), 'ms', 's', 'm', 'h', 'd', 'w'), a RFC 3339 timestamp, epoch millis or date math like 'now-1d/d'."`
+	Server      string           `optional help:"Which server to query against. Used to override the current server config"`
+	Role        string           `optional help:"Which role to query with. Used to override the current role config. Combine with the global --index to search another index"`
+	WindowField string           `optional name:"window-field" help:"Field the time window is filtered by, e.g. event.created. Used to override the role window filter"`
+	httpClient  utils.HTTPClient `-`
+	secrets     secretsFunc      `-`
+}
+
 // SearchCmd represents CLI arguments for search option.
 type SearchCmd struct {
-	Query      string           `optional help:"Text input to query data. Use the same format as you would use in Kibana"`
-	Older      string           `optional default:"now" help:"Data older than. Defaults to current time when not provided. Valid time units are 'ns', 'us' (or 'µs'), 'ms', 's', 'm', 'h'."`
-	Newer      string           `optional default:"15m" help:"Data newer than. Defaults to 15m when not provided. Valid time units are 'ns', 'us' (or 'µs'), 'ms', 's', 'm', 'h'."`
-	Limit      int32            `optional default:"50" help:"Limit the number of messages fetched"`
-	Server     string           `optional help:"Which server to query against. Used to override the current server config"`
-	httpClient utils.HTTPClient `-`
+	FilterFlags
+	Limit        int32          `optional default:"50" help:"Limit the number of messages fetched"`
+	All          bool           `optional help:"Fetch every document within the time window, paginating past --limit"`
+	MaxDocs      int64          `optional help:"Fetch up to this number of documents, paginating past --limit"`
+	PageSize     int32          `optional default:"1000" help:"Number of documents fetched per request when paginating"`
+	Scroll       bool           `optional help:"Fetch every document within the time window using the scroll API. Meant for clusters rejecting search_after"`
+	KeepAlive    string         `optional default:"1m" help:"How long Elasticsearch keeps the scroll context, or the point in time --all and --max-docs read from, alive between batches"`
+	Format       string         `optional default:"json" enum:"json,csv,tsv,table" help:"Output format. One of 'json', 'csv', 'tsv' or 'table'"`
+	Fields       []string       `optional help:"Comma separated source fields printed as columns by csv, tsv and table formats, e.g. @timestamp,clientip. Nested objects are flattened to dotted names and arrays are joined with '|'. Defaults to every field of the first hit, or @timestamp and message for tables"`
+	Follow       bool           `optional help:"Keep polling for new documents, printing them in chronological order until interrupted"`
+	Interval     time.Duration  `optional default:"5s" help:"How often to poll for new documents when following"`
+	Template     string         `optional xor:"template" help:"Go template rendering each hit, e.g. '{{._source.@timestamp}} {{._source.message}}'. Helpers: json, date, default, pad, padLeft and field. Overrides --format"`
+	TemplateFile string         `optional xor:"template" type:"existingfile" help:"File holding the Go template rendering each hit. Overrides --format"`
+	printer      output.Printer `-`
+}
+
+// MsearchCmd represents CLI arguments for msearch option.
+type MsearchCmd struct {
+	FilterFlags
+	File  string `optional type:"existingfile" help:"NDJSON file holding a query per line: an object with a query or dsl field, and optional label and index fields"`
+	Limit int32  `optional default:"10" help:"Limit the number of documents fetched per query. Use 0 to only count them"`
+}
+
+// CountCmd represents CLI arguments for count option.
+type CountCmd struct {
+	FilterFlags
+}
+
+// HistogramCmd represents CLI arguments for histogram option.
+type HistogramCmd struct {
+	FilterFlags
+	Interval string `optional help:"Bucket interval, e.g. 30s, 5m, 1h or 1d. Picked from the time window when not provided"`
+	Format   string `optional default:"bars" enum:"bars,sparkline,csv" help:"Output format. One of 'bars', 'sparkline' or 'csv'"`
+}
+
+// TopCmd represents CLI arguments for top option.
+type TopCmd struct {
+	FilterFlags
+	Field string `required help:"Field to find the most common values of, e.g. clientip. Text fields usually need the keyword sub-field, e.g. message.keyword"`
+	Size  int32  `optional default:"20" help:"Number of values to print"`
+	Other bool   `optional help:"Also print how many documents hold any other value"`
+}
+
+// PingCmd represents CLI arguments for ping option.
+type PingCmd struct {
+	Server        string           `optional help:"Which server to check. Defaults to the current server"`
+	UpdateVersion bool             `optional name:"update-version" help:"Store the version the server reports in its definition"`
+	httpClient    utils.HTTPClient `-`
+}
+
+// OverrideFlags represents global CLI arguments overriding the configuration file and KISHELL_* environment variables.
+type OverrideFlags struct {
+	Config        string `optional type:"path" help:"Config file to use instead of ~/.kishell. Overrides KISHELL_CONFIG"`
+	ServerURL     string `optional name:"server-url" help:"Server URL, e.g. https://kibana.example.com:5601. Overrides KISHELL_SERVER_URL"`
+	ServerType    string `optional name:"server-type" help:"Server type, either kibana or elasticsearch. Overrides KISHELL_SERVER_TYPE"`
+	KibanaVersion string `optional name:"kibana-version" help:"Kibana version. Overrides KISHELL_KIBANA_VERSION"`
+	ESVersion     string `optional name:"es-version" help:"Elasticsearch version of elasticsearch servers. Asked to the server when none is configured. Overrides KISHELL_ES_VERSION"`
+	Username      string `optional help:"Username for basic authentication. Overrides KISHELL_USERNAME"`
+	Password      string `optional help:"Password for basic authentication. Overrides KISHELL_PASSWORD"`
+	Index         string `optional help:"Index pattern to search, e.g. search --index=audit-*. Overrides the role index and KISHELL_INDEX"`
+	WindowFilter  string `optional name:"window-filter" help:"Field the time window is filtered by, e.g. search --window-filter=event.created. Overrides the role window filter and KISHELL_WINDOW_FILTER"`
 }
 
 // CLI represents possible CLI options.
 var CLI struct {
-	Debug     bool         `help:"Enable debug mode."`
+	Debug bool `help:"Enable debug mode."`
+	OverrideFlags
 	Configure ConfigureCmd `cmd help:"Init ES server configs"`
+	Count     CountCmd     `cmd help:"Count documents matching a query without fetching them"`
+	Histogram HistogramCmd `cmd help:"Count documents over time"`
 	List      ListCmd      `cmd help:"Show the current server configs"`
-	Search    SearchCmd    `cmd help:"Search for data"`
+	Msearch   MsearchCmd   `cmd help:"Run several queries in one multi-search request"`
+	Ping      PingCmd      `cmd help:"Check a server is reachable, trusted and accepts the credentials, and compare its version"`
+	Search    SearchCmd    `cmd help:"Search for data. --server and --role accept comma separated lists, e.g. --server=us,eu, to search several at once"`
+	Top       TopCmd       `cmd help:"Show the most common values of a field"`
 	Use       UseCmd       `cmd help:"Switch between configured server/role"`
 }
 
-// OlderAsTimestamp converts a ISO-8601 period as string in timestamp.
-func (s *SearchCmd) OlderAsTimestamp() (int64, error) {
-	return toTimestamp(s.Older)
+// OlderAsTimestamp converts the upper bound time expression in timestamp.
+func (f *FilterFlags) OlderAsTimestamp() (int64, error) {
+	return toTimestamp(f.Older, true)
 }
 
-// NewerAsTimestamp converts a ISO-8601 period as string in timestamp.
-func (s *SearchCmd) NewerAsTimestamp() (int64, error) {
-	return toTimestamp(s.Newer)
+// NewerAsTimestamp converts the lower bound time expression in timestamp.
+func (f *FilterFlags) NewerAsTimestamp() (int64, error) {
+	return toTimestamp(f.Newer, false)
+}
+
+// AfterApply keeps the override flags and environment variables configure server option takes fields from.
+func (c *ConfigureServerCmd) AfterApply(flags *OverrideFlags) error {
+	c.overrides = config.EnvOverrides().Merge(flags.overrides())
+	return nil
+}
+
+// AfterApply keeps the override flags and environment variables configure role option takes fields from.
+func (c *ConfigureRoleCmd) AfterApply(flags *OverrideFlags) error {
+	c.overrides = config.EnvOverrides().Merge(flags.overrides())
+	return nil
 }
 
 // AfterApply defines the http client instance to used once search option is identified to take execution.
@@ -72,16 +221,54 @@ func (s *SearchCmd) AfterApply(h *utils.DefaultHTTPClient) error {
 	return nil
 }
 
-func toTimestamp(period string) (int64, error) {
-	now := time.Now().Unix() * 1000
-	if len(period) <= 0 || period == "now" {
-		return now, nil
-	}
-	duration, err := time.ParseDuration(period)
-	if err != nil {
-		return -1, err
+// AfterApply defines the http client instance to used once msearch option is identified to take execution.
+func (m *MsearchCmd) AfterApply(h *utils.DefaultHTTPClient) error {
+	m.httpClient = h
+	return nil
+}
+
+// AfterApply defines the http client instance to used once count option is identified to take execution.
+func (c *CountCmd) AfterApply(h *utils.DefaultHTTPClient) error {
+	c.httpClient = h
+	return nil
+}
+
+// AfterApply defines the http client instance to used once histogram option is identified to take execution.
+func (h *HistogramCmd) AfterApply(client *utils.DefaultHTTPClient) error {
+	h.httpClient = client
+	return nil
+}
+
+// AfterApply defines the http client instance to used once top option is identified to take execution.
+func (t *TopCmd) AfterApply(h *utils.DefaultHTTPClient) error {
+	t.httpClient = h
+	return nil
+}
+
+// AfterApply defines the http client instance to used once ping option is identified to take execution.
+func (p *PingCmd) AfterApply(h *utils.DefaultHTTPClient) error {
+	p.httpClient = h
+	return nil
+}
+
+// onInterrupt calls cleanup and exits once kishell gets interrupted (e.g. Ctrl-C).
+// The returned function stops listening for interruptions.
+func onInterrupt(cleanup func()) func() {
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+			cleanup()
+			os.Exit(130)
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
 	}
-	return now - duration.Milliseconds(), nil
 }
 
 // Run the option found through CLI arguments.
@@ -98,10 +285,37 @@ func Parse() Option {
 	httpClient := &utils.DefaultHTTPClient{
 		Timeout: 30 * time.Second,
 	}
-	context := kong.Parse(&CLI, kong.Bind(httpClient))
+	context := kong.Parse(&CLI, kong.Bind(httpClient, &CLI.OverrideFlags))
+	configuration, err := CLI.OverrideFlags.load()
+	context.FatalIfErrorf(err)
 	opt := Option{
 		Context:    context,
-		ConfigFile: config.LoadDefaultConfig(),
+		ConfigFile: configuration,
 	}
 	return opt
 }
+
+// load loads the configuration file with the overrides layered on top. Flags take precedence over environment
+// variables, which take precedence over the configuration file.
+func (o *OverrideFlags) load() (config.Configuration, error) {
+	var configuration config.Configuration
+	if len(o.Config) > 0 {
+		configuration = config.LoadConfig(o.Config)
+	} else {
+		configuration = config.LoadDefaultConfig()
+	}
+	return config.WithOverrides(configuration, config.EnvOverrides().Merge(o.overrides()))
+}
+
+func (o *OverrideFlags) overrides() config.Overrides {
+	return config.Overrides{
+		ServerURL:            o.ServerURL,
+		ServerType:           o.ServerType,
+		KibanaVersion:        o.KibanaVersion,
+		ElasticsearchVersion: o.ESVersion,
+		Username:             o.Username,
+		Password:             o.Password,
+		Index:                o.Index,
+		WindowFilter:         o.WindowFilter,
+	}
+}
@@ -1,6 +1,9 @@
 package options
 
 import (
+	"github.com/alecthomas/kong"
+	"github.com/sidilabs/kishell/pkg/config"
+	"github.com/sidilabs/kishell/pkg/utils"
 	"os"
 	"testing"
 )
@@ -13,3 +16,42 @@ func TestCLI(t *testing.T) {
 	}
 	option.Run()
 }
+
+func TestOverrideFlagsTakePrecedence(t *testing.T) {
+	os.Setenv(config.ServerURLEnv, "http://env.test:5601")
+	os.Setenv(config.IndexEnv, "env-*")
+	defer os.Unsetenv(config.ServerURLEnv)
+	defer os.Unsetenv(config.IndexEnv)
+
+	flags := OverrideFlags{
+		Config: "../../testdata/kishell-config.json",
+		Index:  "flag-*",
+	}
+	configuration, err := flags.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server := configuration.GetCurrentServer(); server.Hostname != "env.test" || server.Port != "5601" {
+		t.Errorf("Environment must override the config file, got %+v", server)
+	}
+	if role := configuration.GetCurrentRole(); role.Index != "flag-*" {
+		t.Errorf("Flags must override the environment, got %+v", role)
+	}
+	if configuration.GetServer() != "local" {
+		t.Errorf("Config file must be loaded from --config, got %s", configuration.GetServer())
+	}
+}
+
+func TestSearchRoleFlags(t *testing.T) {
+	parser, err := kong.New(&CLI, kong.Bind(&utils.DefaultHTTPClient{}, &CLI.OverrideFlags))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = parser.Parse([]string{"search", "--role=audit", "--index=audit-*", "--window-field=event.created"})
+	if err != nil {
+		t.Fatal("Search must accept the role, index and window field flags", err)
+	}
+	if CLI.Search.Role != "audit" || CLI.Index != "audit-*" || CLI.Search.WindowField != "event.created" {
+		t.Errorf("Unexpected flags %+v %+v", CLI.Search.FilterFlags, CLI.OverrideFlags)
+	}
+}
@@ -0,0 +1,175 @@
+package options
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-http-utils/headers"
+	"github.com/sidilabs/kishell/pkg/config"
+	"github.com/sidilabs/kishell/pkg/utils"
+)
+
+const (
+	kibanaStatusPath = "/api/status"
+	pingTimeout      = 5 * time.Second
+	pingStepFormat   = "%-15s %-7s %s\n"
+)
+
+// Run the ping option.
+// Checks the server step by step: reachability, TLS handshake (https only), authentication and the version it reports
+// against the configured one. Each step is reported as it completes and the first failing one stops the checks.
+func (p *PingCmd) Run(ctx *Context) error {
+	server, err := resolveServer(ctx.Configuration, p.Server, secretBackendOnce(ctx.Configuration))
+	if err != nil {
+		return err
+	}
+	if len(server.Hostname) <= 0 {
+		return errors.New("no server to ping. Use configure option or --server-url first")
+	}
+	address := net.JoinHostPort(server.Hostname, server.GetPort())
+
+	connection, err := net.DialTimeout("tcp", address, pingTimeout)
+	if err != nil {
+		return p.failed("reachability", err)
+	}
+	connection.Close()
+	p.passed("reachability", fmt.Sprintf("%s accepts connections", address))
+
+	if server.Protocol == "https" {
+		detail, err := p.handshake(server, address)
+		if err != nil {
+			return p.failed("tls", err)
+		}
+		p.passed("tls", detail)
+	}
+
+	reported, err := serverVersion(server, p.httpClient)
+	if err != nil {
+		return p.failed("authentication", err)
+	}
+	if len(server.Authorization()) > 0 {
+		p.passed("authentication", "credentials accepted")
+	} else {
+		p.passed("authentication", "no credentials configured, anonymous access accepted")
+	}
+
+	return p.checkVersion(ctx.Configuration, server, reported)
+}
+
+// handshake runs the TLS handshake with the server TLS settings, giving the certificate subject and expiry.
+func (p *PingCmd) handshake(server config.Server, address string) (string, error) {
+	tlsConfig, err := tlsSettings(server).Config()
+	if err != nil {
+		return "", err
+	}
+	tlsConfig.ServerName = server.Hostname
+	connection, err := tls.DialWithDialer(&net.Dialer{Timeout: pingTimeout}, "tcp", address, tlsConfig)
+	if err != nil {
+		return "", err
+	}
+	defer connection.Close()
+	certificates := connection.ConnectionState().PeerCertificates
+	if len(certificates) <= 0 {
+		return "handshake succeeded", nil
+	}
+	detail := fmt.Sprintf("certificate for %s valid until %s", certificates[0].Subject.CommonName,
+		certificates[0].NotAfter.Format("2006-01-02"))
+	if server.InsecureSkipVerify {
+		detail += " (not verified)"
+	}
+	return detail, nil
+}
+
+// serverVersion fetches the Kibana status, or the Elasticsearch root, giving the version number the server reports.
+func serverVersion(server config.Server, client utils.HTTPClient) (string, error) {
+	httpClient, err := serverHTTPClient(server, client)
+	if err != nil {
+		return "", err
+	}
+	path := kibanaStatusPath
+	if server.GetType() == config.ElasticsearchServer {
+		path = "/"
+	}
+	endpoint := fmt.Sprintf("%s://%s:%s%s", server.Protocol, server.Hostname, server.GetPort(), path)
+	request, err := httpClient.NewRequest("GET", endpoint, &bytes.Buffer{})
+	if err != nil {
+		return "", err
+	}
+	if authorization := server.Authorization(); len(authorization) > 0 {
+		request.Header.Add(headers.Authorization, authorization)
+	}
+	response, err := httpClient.Call(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusUnauthorized || response.StatusCode == http.StatusForbidden {
+		return "", fmt.Errorf("server rejected the credentials (%s)", response.Status)
+	}
+	data, err := parseResponse(response)
+	if err != nil {
+		return "", err
+	}
+	version, _ := data.Payload["version"].(map[string]interface{})
+	number, ok := version["number"].(string)
+	if !ok {
+		return "", fmt.Errorf("unable to find the version in the %s response", path)
+	}
+	return number, nil
+}
+
+// checkVersion compares the reported version against the configured one, storing it when asked to.
+func (p *PingCmd) checkVersion(configuration config.Configuration, server config.Server, reported string) error {
+	if server.GetVersion() == reported {
+		p.passed("version", fmt.Sprintf("server reports %s as configured", reported))
+		return nil
+	}
+	if p.UpdateVersion {
+		if err := p.storeVersion(configuration, reported); err != nil {
+			return p.failed("version", err)
+		}
+		p.passed("version", fmt.Sprintf("server reports %s, stored in the server definition", reported))
+		return nil
+	}
+	if len(server.GetVersion()) <= 0 && server.GetType() == config.ElasticsearchServer {
+		p.passed("version", fmt.Sprintf("server reports %s, none configured. Use --update-version to store it",
+			reported))
+		return nil
+	}
+	return p.failed("version", fmt.Errorf("server reports %s but %s is configured. Use --update-version to store it",
+		reported, server.GetVersion()))
+}
+
+// storeVersion writes the version to the stored server definition, leaving the overrides out of it.
+func (p *PingCmd) storeVersion(configuration config.Configuration, version string) error {
+	name := p.Server
+	if len(name) <= 0 {
+		name = configuration.GetServer()
+	}
+	stored := config.Stored(configuration)
+	server, ok := stored.FindServer(name)
+	if !ok {
+		return errors.New("the server is not stored in the config file, so its version can't be updated")
+	}
+	if server.GetType() == config.ElasticsearchServer {
+		server.ElasticsearchVersion = version
+	} else {
+		server.KibanaVersion = version
+	}
+	stored.AddServer(name, server)
+	return stored.Save()
+}
+
+func (p *PingCmd) passed(step string, detail string) {
+	fmt.Printf(pingStepFormat, step, "ok", detail)
+}
+
+func (p *PingCmd) failed(step string, err error) error {
+	fmt.Printf(pingStepFormat, step, "failed", err)
+	return fmt.Errorf("ping failed at %s: %s", step, err)
+}
@@ -0,0 +1,197 @@
+package options
+
+import (
+	"github.com/go-http-utils/headers"
+	"github.com/sidilabs/kishell/pkg/config"
+	"github.com/sidilabs/kishell/pkg/utils"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newStatusServer stands for a server answering its status with the version, and rejecting any other credentials
+// than the expected ones.
+func newStatusServer(path string, version string, authorization string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(headers.Authorization) != authorization {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != path {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set(headers.ContentType, jsonContentType)
+		w.Write([]byte(`{"name":"ut","version":{"number":"` + version + `"}}`))
+	}))
+}
+
+// pingServer gives the server definition reaching the test server.
+func pingServer(t *testing.T, testServer *httptest.Server, kibanaVersion string) config.Server {
+	endpoint, err := url.Parse(testServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config.Server{
+		Protocol:      endpoint.Scheme,
+		Hostname:      endpoint.Hostname(),
+		Port:          endpoint.Port(),
+		KibanaVersion: kibanaVersion,
+		BasicAuth:     "dXQ6dXQ=",
+	}
+}
+
+func newPingCmd(server string) PingCmd {
+	return PingCmd{
+		Server:     server,
+		httpClient: &utils.DefaultHTTPClient{Timeout: 5 * time.Second},
+	}
+}
+
+func TestPingKibana(t *testing.T) {
+	testServer := newStatusServer(kibanaStatusPath, "7.10.2", "Basic dXQ6dXQ=")
+	defer testServer.Close()
+
+	configuration := new(ConfigurationMock)
+	configuration.On("GetCurrentServer").Return(pingServer(t, testServer, "7.10.2"))
+
+	cmd := newPingCmd("")
+	err := cmd.Run(&Context{Configuration: configuration})
+	if err != nil {
+		t.Fatal("Pinging a server matching its definition must succeed", err)
+	}
+	configuration.AssertNotCalled(t, "Save")
+}
+
+func TestPingElasticsearchRoot(t *testing.T) {
+	testServer := newStatusServer("/", "8.11.0", "Basic dXQ6dXQ=")
+	defer testServer.Close()
+
+	server := pingServer(t, testServer, "")
+	server.Type = config.ElasticsearchServer
+	configuration := new(ConfigurationMock)
+	configuration.On("GetCurrentServer").Return(config.Server{})
+	configuration.On("FindServer", "es").Return(server, true)
+
+	cmd := newPingCmd("es")
+	err := cmd.Run(&Context{Configuration: configuration})
+	if err != nil {
+		t.Fatal("Elasticsearch servers without a version configured must be pinged successfully", err)
+	}
+}
+
+func TestPingRejectedCredentials(t *testing.T) {
+	testServer := newStatusServer(kibanaStatusPath, "7.10.2", "Basic b3RoZXI6b3RoZXI=")
+	defer testServer.Close()
+
+	configuration := new(ConfigurationMock)
+	configuration.On("GetCurrentServer").Return(pingServer(t, testServer, "7.10.2"))
+
+	cmd := newPingCmd("")
+	err := cmd.Run(&Context{Configuration: configuration})
+	if err == nil || !strings.Contains(err.Error(), "authentication") || !strings.Contains(err.Error(), "401") {
+		t.Fatal("Rejected credentials must fail the authentication step", err)
+	}
+}
+
+func TestPingVersionMismatch(t *testing.T) {
+	testServer := newStatusServer(kibanaStatusPath, "7.17.3", "Basic dXQ6dXQ=")
+	defer testServer.Close()
+
+	configuration := new(ConfigurationMock)
+	configuration.On("GetCurrentServer").Return(pingServer(t, testServer, "7.10.2"))
+
+	cmd := newPingCmd("")
+	err := cmd.Run(&Context{Configuration: configuration})
+	if err == nil || !strings.Contains(err.Error(), "server reports 7.17.3 but 7.10.2 is configured") {
+		t.Fatal("A version mismatch must fail the version step", err)
+	}
+	configuration.AssertNotCalled(t, "Save")
+}
+
+func TestPingUpdateVersion(t *testing.T) {
+	testServer := newStatusServer(kibanaStatusPath, "7.17.3", "Basic dXQ6dXQ=")
+	defer testServer.Close()
+
+	server := pingServer(t, testServer, "7.10.2")
+	updated := server
+	updated.KibanaVersion = "7.17.3"
+	configuration := new(ConfigurationMock)
+	configuration.On("GetCurrentServer").Return(server)
+	configuration.On("GetServer").Return("ut")
+	configuration.On("FindServer", "ut").Return(server, true)
+	configuration.On("AddServer", "ut", updated).Return()
+	configuration.On("Save").Return(nil)
+
+	cmd := newPingCmd("")
+	cmd.UpdateVersion = true
+	err := cmd.Run(&Context{Configuration: configuration})
+	if err != nil {
+		t.Fatal("Updating the version must succeed", err)
+	}
+	configuration.AssertExpectations(t)
+}
+
+func TestPingUpdateElasticsearchVersion(t *testing.T) {
+	testServer := newStatusServer("/", "8.11.0", "Basic dXQ6dXQ=")
+	defer testServer.Close()
+
+	server := pingServer(t, testServer, "")
+	server.Type = config.ElasticsearchServer
+	updated := server
+	updated.ElasticsearchVersion = "8.11.0"
+	configuration := new(ConfigurationMock)
+	configuration.On("GetCurrentServer").Return(config.Server{})
+	configuration.On("FindServer", "es").Return(server, true)
+	configuration.On("AddServer", "es", updated).Return()
+	configuration.On("Save").Return(nil)
+
+	cmd := newPingCmd("es")
+	cmd.UpdateVersion = true
+	err := cmd.Run(&Context{Configuration: configuration})
+	if err != nil {
+		t.Fatal("Updating the Elasticsearch version must succeed", err)
+	}
+	configuration.AssertExpectations(t)
+}
+
+func TestPingUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().(*net.TCPAddr)
+	listener.Close()
+
+	configuration := new(ConfigurationMock)
+	configuration.On("GetCurrentServer").Return(config.Server{
+		Protocol: "http",
+		Hostname: "127.0.0.1",
+		Port:     strconv.Itoa(address.Port),
+	})
+
+	cmd := newPingCmd("")
+	err = cmd.Run(&Context{Configuration: configuration})
+	if err == nil || !strings.Contains(err.Error(), "reachability") {
+		t.Fatal("A closed port must fail the reachability step", err)
+	}
+}
+
+func TestPingUntrustedCertificate(t *testing.T) {
+	testServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer testServer.Close()
+
+	configuration := new(ConfigurationMock)
+	configuration.On("GetCurrentServer").Return(pingServer(t, testServer, "7.10.2"))
+
+	cmd := newPingCmd("")
+	err := cmd.Run(&Context{Configuration: configuration})
+	if err == nil || !strings.Contains(err.Error(), "tls") {
+		t.Fatal("An untrusted certificate must fail the TLS step", err)
+	}
+}
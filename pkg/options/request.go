@@ -0,0 +1,228 @@
+package options
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+const (
+	highlightPreTag    = "@kibana-highlighted-field@"
+	highlightPostTag   = "@/kibana-highlighted-field@"
+	searchTimeout      = "30000ms"
+	epochMillisFormat  = "epoch_millis"
+	unmappedSortType   = "boolean"
+	maxFragmentSize    = 2147483647
+	msearchPreference  = 1569331617740
+	defaultQueryFields = "*"
+)
+
+// searchRequest represents the body of a search request. Fields are sent in the order Kibana sends them, leaving out
+// the ones not set.
+type searchRequest struct {
+	Version        bool                   `json:"version,omitempty"`
+	Size           int32                  `json:"size"`
+	TrackTotalHits bool                   `json:"track_total_hits,omitempty"`
+	Sort           []map[string]sortOrder `json:"sort,omitempty"`
+	SearchAfter    json.RawMessage        `json:"search_after,omitempty"`
+	PointInTime    *pointInTime           `json:"pit,omitempty"`
+	Source         *sourceFilter          `json:"_source,omitempty"`
+	Aggs           map[string]aggregation `json:"aggs,omitempty"`
+	StoredFields   []string               `json:"stored_fields,omitempty"`
+	ScriptFields   *struct{}              `json:"script_fields,omitempty"`
+	Query          boolQuery              `json:"query"`
+	Highlight      *highlight             `json:"highlight,omitempty"`
+	Timeout        string                 `json:"timeout,omitempty"`
+}
+
+type sortOrder struct {
+	Order        string `json:"order"`
+	UnmappedType string `json:"unmapped_type,omitempty"`
+}
+
+type sourceFilter struct {
+	Excludes []string `json:"excludes"`
+}
+
+type aggregation struct {
+	DateHistogram *dateHistogram    `json:"date_histogram,omitempty"`
+	Terms         *termsAggregation `json:"terms,omitempty"`
+}
+
+// dateHistogram represents a date_histogram aggregation. Only one of the interval fields is set, as picked by
+// intervalKey.
+type dateHistogram struct {
+	Field            string          `json:"field"`
+	Interval         string          `json:"interval,omitempty"`
+	FixedInterval    string          `json:"fixed_interval,omitempty"`
+	CalendarInterval string          `json:"calendar_interval,omitempty"`
+	TimeZone         string          `json:"time_zone"`
+	MinDocCount      int             `json:"min_doc_count"`
+	ExtendedBounds   *extendedBounds `json:"extended_bounds,omitempty"`
+}
+
+type extendedBounds struct {
+	Min int64 `json:"min"`
+	Max int64 `json:"max"`
+}
+
+type termsAggregation struct {
+	Field string `json:"field"`
+	Size  int32  `json:"size"`
+}
+
+type highlight struct {
+	PreTags      []string            `json:"pre_tags"`
+	PostTags     []string            `json:"post_tags"`
+	Fields       map[string]struct{} `json:"fields"`
+	FragmentSize int                 `json:"fragment_size"`
+}
+
+type boolQuery struct {
+	Bool boolClauses `json:"bool"`
+}
+
+type boolClauses struct {
+	Must    []interface{} `json:"must"`
+	Filter  []interface{} `json:"filter"`
+	Should  []interface{} `json:"should"`
+	MustNot []interface{} `json:"must_not"`
+}
+
+type rangeQuery struct {
+	Range map[string]rangeBounds `json:"range"`
+}
+
+type rangeBounds struct {
+	Gte    int64  `json:"gte"`
+	Lte    int64  `json:"lte"`
+	Format string `json:"format"`
+}
+
+type queryStringQuery struct {
+	QueryString queryString `json:"query_string"`
+}
+
+type queryString struct {
+	Query           string `json:"query"`
+	AnalyzeWildcard bool   `json:"analyze_wildcard"`
+	DefaultField    string `json:"default_field"`
+}
+
+// msearchHeader represents the header line preceding each search body of a multi-search request.
+type msearchHeader struct {
+	Index             string `json:"index"`
+	IgnoreUnavailable bool   `json:"ignore_unavailable"`
+	Preference        int64  `json:"preference"`
+}
+
+func newMsearchHeader(index string) msearchHeader {
+	return msearchHeader{Index: index, IgnoreUnavailable: true, Preference: msearchPreference}
+}
+
+type clearScrollRequest struct {
+	ScrollID []string `json:"scroll_id"`
+}
+
+// pointInTime represents the point in time a search reads from, as opened by the _pit API.
+type pointInTime struct {
+	ID        string `json:"id"`
+	KeepAlive string `json:"keep_alive"`
+}
+
+type closePointInTimeRequest struct {
+	ID string `json:"id"`
+}
+
+// query gives the bool query matching the clause within the time window.
+func (p SearchParams) query() boolQuery {
+	return boolQuery{Bool: boolClauses{
+		Must: []interface{}{
+			json.RawMessage(p.Clause),
+			rangeQuery{Range: map[string]rangeBounds{
+				p.WindowFilter: {Gte: p.Newer, Lte: p.Older, Format: epochMillisFormat},
+			}},
+		},
+		Filter:  []interface{}{},
+		Should:  []interface{}{},
+		MustNot: []interface{}{},
+	}}
+}
+
+// dateHistogram gives the date_histogram aggregation over the window filter, with the interval set under the key
+// the server expects.
+func (p SearchParams) dateHistogram(minDocCount int) *dateHistogram {
+	histogram := &dateHistogram{
+		Field:       p.WindowFilter,
+		TimeZone:    p.Zone,
+		MinDocCount: minDocCount,
+	}
+	switch p.IntervalKey {
+	case "calendar_interval":
+		histogram.CalendarInterval = p.Interval
+	case "fixed_interval":
+		histogram.FixedInterval = p.Interval
+	default:
+		histogram.Interval = p.Interval
+	}
+	return histogram
+}
+
+// searchBody gives the search request Kibana Discover would send, sorted by the window filter and then the
+// tiebreaker when paginating.
+func (p SearchParams) searchBody() searchRequest {
+	sort := []map[string]sortOrder{{p.WindowFilter: {Order: p.Order, UnmappedType: unmappedSortType}}}
+	if len(p.Tiebreaker) > 0 {
+		sort = append(sort, map[string]sortOrder{p.Tiebreaker: {Order: p.Order}})
+	}
+	return searchRequest{
+		Version:      true,
+		Size:         p.Size,
+		Sort:         sort,
+		SearchAfter:  json.RawMessage(p.SearchAfter),
+		PointInTime:  p.PointInTime,
+		Source:       &sourceFilter{Excludes: []string{}},
+		StoredFields: []string{"*"},
+		ScriptFields: &struct{}{},
+		Query:        p.query(),
+		Highlight: &highlight{
+			PreTags:      []string{highlightPreTag},
+			PostTags:     []string{highlightPostTag},
+			Fields:       map[string]struct{}{"*": {}},
+			FragmentSize: maxFragmentSize,
+		},
+		Timeout: searchTimeout,
+	}
+}
+
+// countBody gives the search request counting the documents without fetching any.
+func (p SearchParams) countBody() searchRequest {
+	return searchRequest{
+		TrackTotalHits: true,
+		Query:          p.query(),
+	}
+}
+
+// queryStringClause gives the query_string clause matching the query, as typed in Kibana.
+func queryStringClause(query string) (string, error) {
+	clause, err := json.Marshal(queryStringQuery{QueryString: queryString{
+		Query:           query,
+		AnalyzeWildcard: true,
+		DefaultField:    defaultQueryFields,
+	}})
+	if err != nil {
+		return "", err
+	}
+	return string(clause), nil
+}
+
+// buildBody marshals the request as JSON. Every value is escaped, so user input can't break out of the field it is
+// given for.
+func buildBody(request interface{}) (bytes.Buffer, error) {
+	var out bytes.Buffer
+	content, err := json.Marshal(request)
+	if err != nil {
+		return out, err
+	}
+	out.Write(content)
+	return out, nil
+}
@@ -0,0 +1,217 @@
+package options
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/sidilabs/kishell/pkg/config"
+	"strings"
+	"testing"
+)
+
+// hostileQueries are query strings which used to break the request body, or inject DSL into it, when interpolated
+// raw into a JSON template.
+var hostileQueries = []string{
+	`message:"disk full"`,
+	`path:C:\Windows\System32`,
+	`message:"a \"quoted\" word"`,
+	`\`,
+	`"`,
+	`foo"}},{"match_all":{}}],"should":[{"match_all":{}`,
+	`foo","default_field":"password`,
+	`{{.Index}} {{template "x"}}`,
+	"line\nbreak\r\ttab",
+	"nul\x00byte",
+	`<script>alert("x")</script> & more`,
+	`emoji 🔥 and accents ção`,
+	`\u0022 looks like a quote`,
+	`*`,
+	``,
+}
+
+// mustClause gives the bool must clauses of the request body, failing when the body isn't valid JSON.
+func mustClause(t *testing.T, body bytes.Buffer) []interface{} {
+	var request map[string]interface{}
+	if err := json.Unmarshal(body.Bytes(), &request); err != nil {
+		t.Fatalf("Request body must be valid JSON, got %s: %s", body.String(), err)
+	}
+	query, _ := request["query"].(map[string]interface{})
+	boolQuery, _ := query["bool"].(map[string]interface{})
+	must, _ := boolQuery["must"].([]interface{})
+	for _, key := range []string{"filter", "should", "must_not"} {
+		if clauses, _ := boolQuery[key].([]interface{}); len(clauses) > 0 {
+			t.Errorf("No %s clause must be injected, got %s", key, body.String())
+		}
+	}
+	return must
+}
+
+func TestHostileQueryStrings(t *testing.T) {
+	for _, query := range hostileQueries {
+		filterFlags := FilterFlags{Query: []string{query}, Older: "now", Newer: "15m"}
+		clause, err := filterFlags.clause()
+		if err != nil {
+			t.Fatal(err)
+		}
+		searchParams := SearchParams{
+			Index:        "ut-*",
+			Size:         10,
+			WindowFilter: "@timestamp",
+			Clause:       clause,
+			Order:        descendingOrder,
+			Interval:     "3h",
+			IntervalKey:  "fixed_interval",
+			Field:        "clientip",
+		}
+		bodies := map[string]searchRequest{
+			"search":    searchParams.searchBody(),
+			"count":     searchParams.countBody(),
+			"histogram": histogramBody(searchParams),
+			"top":       topBody(searchParams),
+		}
+		for name, request := range bodies {
+			body, err := buildBody(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			must := mustClause(t, body)
+			if len(must) != 2 {
+				t.Errorf("%s body for %q must hold the query and the time range only, got %s", name, query, body.String())
+				continue
+			}
+			clauseObj, _ := must[0].(map[string]interface{})
+			if len(query) <= 0 {
+				if _, ok := clauseObj["match_all"]; !ok {
+					t.Errorf("%s body for an empty query must match every document, got %s", name, body.String())
+				}
+				continue
+			}
+			queryStringObj, _ := clauseObj["query_string"].(map[string]interface{})
+			if len(clauseObj) != 1 || queryStringObj["query"] != query || queryStringObj["default_field"] != "*" {
+				t.Errorf("%s body must hold the query %q as is, got %s", name, query, body.String())
+			}
+		}
+	}
+}
+
+func TestHostileFieldNames(t *testing.T) {
+	clause, err := queryStringClause("response:404")
+	if err != nil {
+		t.Fatal(err)
+	}
+	searchParams := SearchParams{
+		Index:        `ut-*"},{"index":"secrets`,
+		WindowFilter: `@timestamp"}}],"must_not":[{"match_all":{}}],"x":[{"y":{"z`,
+		Clause:       clause,
+		Order:        descendingOrder,
+		Interval:     "3h",
+		Field:        `clientip","size":100000,"x":"`,
+		Size:         5,
+	}
+	for name, request := range map[string]searchRequest{
+		"search": searchParams.searchBody(),
+		"top":    topBody(searchParams),
+	} {
+		body, err := buildBody(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		must := mustClause(t, body)
+		timeRange, _ := must[1].(map[string]interface{})["range"].(map[string]interface{})
+		if _, ok := timeRange[searchParams.WindowFilter]; !ok || len(timeRange) != 1 {
+			t.Errorf("%s body must filter the time window by the field as is, got %s", name, body.String())
+		}
+	}
+
+	body, err := buildBody(topBody(searchParams))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var request searchRequest
+	if err := json.Unmarshal(body.Bytes(), &request); err != nil {
+		t.Fatal(err)
+	}
+	if terms := request.Aggs[topAggregation].Terms; terms.Field != searchParams.Field || terms.Size != 5 {
+		t.Errorf("Terms aggregation must keep the field as is, got %+v", terms)
+	}
+
+	header, err := buildBody(newMsearchHeader(searchParams.Index + "\n{\"index\":\"injected\"}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(header.String(), "\n") {
+		t.Errorf("Multi-search header must stay on a single line, got %s", header.String())
+	}
+}
+
+func TestHostileScrollID(t *testing.T) {
+	scrollParams := ScrollParams{KeepAlive: "1m", ScrollID: `abc","scroll":"999d`}
+	body, err := buildBody(scrollParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded ScrollParams
+	if err := json.Unmarshal(body.Bytes(), &decoded); err != nil || decoded != scrollParams {
+		t.Errorf("Scroll request must keep the scroll id as is, got %s", body.String())
+	}
+}
+
+func TestHostileQueryThroughKibanaInternalSearch(t *testing.T) {
+	query := `message:"disk full" OR path:C:\tmp`
+	clause, err := queryStringClause(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	searchParams := SearchParams{Index: `ut-*`, WindowFilter: "@timestamp", Clause: clause, Order: descendingOrder}
+	body, err := buildBody(searchParams.searchBody())
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := buildBody(internalSearchRequest{Params: InternalSearchParams{
+		Index:             `ut-*","secrets`,
+		IgnoreUnavailable: true,
+		Body:              json.RawMessage(body.Bytes()),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var request internalSearchRequest
+	if err := json.Unmarshal(payload.Bytes(), &request); err != nil {
+		t.Fatalf("Internal search payload must be valid JSON, got %s: %s", payload.String(), err)
+	}
+	if request.Params.Index != `ut-*","secrets` {
+		t.Errorf("Index must be kept as is, got %s", request.Params.Index)
+	}
+	if !strings.Contains(string(request.Params.Body), `"query":"message:\"disk full\" OR path:C:\\tmp"`) {
+		t.Errorf("Query must be escaped once in the wrapped body, got %s", request.Params.Body)
+	}
+}
+
+func TestRequestBodyMatchesKibana(t *testing.T) {
+	searchParams := SearchParams{
+		Index:        "ut-*",
+		Size:         2,
+		WindowFilter: "@timestamp",
+		Zone:         "Z",
+		Clause:       matchAllClause,
+		Order:        descendingOrder,
+		Interval:     "3h",
+		IntervalKey:  intervalKey(config.Server{KibanaVersion: "7.10.2"}, "3h"),
+		Older:        2000,
+		Newer:        1000,
+		Tiebreaker:   tiebreakerField,
+		SearchAfter:  `[1500,"b"]`,
+	}
+	body, err := buildBody(searchParams.searchBody())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"version":true,"size":2,"sort":[{"@timestamp":{"order":"desc","unmapped_type":"boolean"}},{"_id":{"order":"desc"}}],` +
+		`"search_after":[1500,"b"],"_source":{"excludes":[]},` +
+		`"stored_fields":["*"],"script_fields":{},` +
+		`"query":{"bool":{"must":[{"match_all":{}},{"range":{"@timestamp":{"gte":1000,"lte":2000,"format":"epoch_millis"}}}],"filter":[],"should":[],"must_not":[]}},` +
+		`"highlight":{"pre_tags":["@kibana-highlighted-field@"],"post_tags":["@/kibana-highlighted-field@"],"fields":{"*":{}},"fragment_size":2147483647},` +
+		`"timeout":"30000ms"}`
+	if body.String() != expected {
+		t.Errorf("Expected body\n%s\nbut was\n%s", expected, body.String())
+	}
+}
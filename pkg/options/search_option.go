@@ -1,15 +1,23 @@
 package options
 
 import (
-    "bytes"
-    "encoding/json"
-    "fmt"
-    "github.com/go-http-utils/headers"
-    "github.com/sidilabs/kishell/pkg/config"
-    "mime"
-    "net/http"
-    "text/template"
-    "time"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-http-utils/headers"
+	"github.com/sidilabs/kishell/pkg/config"
+	"github.com/sidilabs/kishell/pkg/output"
+	"github.com/sidilabs/kishell/pkg/utils"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
 )
 
 // SearchParams represents attributes used to query for data.
@@ -21,6 +29,13 @@ type SearchParams struct {
 	Clause       string
 	Older        int64
 	Newer        int64
+	Order        string
+	Interval     string
+	IntervalKey  string
+	Field        string
+	Tiebreaker   string
+	SearchAfter  string
+	PointInTime  *pointInTime
 }
 
 // ResponseData represents the response payload.
@@ -29,132 +44,638 @@ type ResponseData struct {
 }
 
 const (
-	kibanaVersionHeaderKey = "kbn-version"
-	postContentType        = "application/x-ndjson"
-	esSearchPath           = "/elasticsearch/_msearch"
-	matchAllClause         = `{"match_all": {}}`
-	queryClauseTemplate    = `{"query_string":{"query":"{{.Query}}","analyze_wildcard":true,"default_field":"*"}}`
-	payloadTemplate        = `{"index":"{{.Index}}","ignore_unavailable":true,"preference":1569331617740}
-{"version":true,"size":{{.Size}},"sort":[{"{{.WindowFilter}}":{"order":"desc","unmapped_type":"boolean"}}],"_source":{"excludes":[]},"aggs":{"2":{"date_histogram":{"field":"{{.WindowFilter}}","interval":"3h","time_zone":"{{.Zone}}","min_doc_count":1}}},"stored_fields":["*"],"script_fields":{},"query":{"bool":{"must":[{{.Clause}},{"range":{"{{.WindowFilter}}":{"gte":{{.Newer}},"lte":{{.Older}},"format":"epoch_millis"}}}],"filter":[],"should":[],"must_not":[]}},"highlight":{"pre_tags":["@kibana-highlighted-field@"],"post_tags":["@/kibana-highlighted-field@"],"fields":{"*":{}},"fragment_size":2147483647},"timeout":"30000ms"}
-`
+	tiebreakerField    = "_id"
+	pitTiebreakerField = "_shard_doc"
+	descendingOrder    = "desc"
+	ascendingOrder     = "asc"
+	matchAllClause     = `{"match_all":{}}`
+	scrollPath         = "/_search/scroll"
+	pitPath            = "/_pit"
+	pitSearchPath      = "/_search"
 )
 
-func (r *ResponseData) printAllSources() error {
-	for _, element := range r.Payload {
-        switch element.(type) {
-        case int:
-        case float64:
-          continue
-        default:
-        }
-        responses := element.([]interface{})
-		for _, item := range responses {
-			response := item.(map[string]interface{})
-			hits := response["hits"].(map[string]interface{})["hits"].([]interface{})
-			for _, hitItem := range hits {
-				hit := hitItem.(map[string]interface{})
-				source := hit["_source"]
-				asJson, err := json.Marshal(source)
-				if err != nil {
-					return err
-				}
-				fmt.Println(string(asJson))
-			}
+// ScrollParams represents attributes used to walk through a scroll context. They make up the scroll request body.
+type ScrollParams struct {
+	KeepAlive string `json:"scroll"`
+	ScrollID  string `json:"scroll_id"`
+}
+
+func (r *ResponseData) printAllSources(printer output.Printer) error {
+	return printSources(printer, r.hits())
+}
+
+func printSources(printer output.Printer, hits []map[string]interface{}) error {
+	for _, hit := range hits {
+		err := printer.Print(hit)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// responses lists every response found in the payload. Payloads coming from _msearch wrap each response in a
+// "responses" list while _search and scroll calls don't.
+func (r *ResponseData) responses() []map[string]interface{} {
+	items, ok := r.Payload["responses"].([]interface{})
+	if !ok {
+		return []map[string]interface{}{r.Payload}
+	}
+	var responses []map[string]interface{}
+	for _, item := range items {
+		if response, ok := item.(map[string]interface{}); ok {
+			responses = append(responses, response)
+		}
+	}
+	return responses
+}
+
+// failure gives the error reported by any of the responses found in the payload.
+func (r *ResponseData) failure() error {
+	for _, response := range r.responses() {
+		cause, ok := response["error"]
+		if !ok {
+			continue
 		}
+		if reason, ok := cause.(map[string]interface{})["reason"]; ok {
+			return fmt.Errorf("search failed - %v", reason)
+		}
+		return fmt.Errorf("search failed - %v", cause)
 	}
 	return nil
 }
 
+// hits collects the hits of every response found in the payload, keeping the order they were returned.
+func (r *ResponseData) hits() []map[string]interface{} {
+	var hits []map[string]interface{}
+	for _, response := range r.responses() {
+		hitsObj, _ := response["hits"].(map[string]interface{})
+		hitItems, _ := hitsObj["hits"].([]interface{})
+		for _, hitItem := range hitItems {
+			if hit, ok := hitItem.(map[string]interface{}); ok {
+				hits = append(hits, hit)
+			}
+		}
+	}
+	return hits
+}
+
+func (r *ResponseData) scrollID() string {
+	scrollID, _ := r.Payload["_scroll_id"].(string)
+	return scrollID
+}
+
+// pointInTimeID gives the point in time id a search returned, which may differ from the one it was sent.
+func (r *ResponseData) pointInTimeID() string {
+	id, _ := r.Payload["pit_id"].(string)
+	return id
+}
+
 // Run the search option.
-// Queries ES server for data.
+// Queries ES server for data, fanning out to every server and role given as comma separated lists.
 // Prints the results in the stdout.
 func (s *SearchCmd) Run(ctx *Context) error {
 	err := ctx.Configuration.CheckEmpty()
 	if err != nil {
 		return err
 	}
-	clause := matchAllClause
-	if len(s.Query) > 0 {
-		out, err := buildFromTemplate("query", queryClauseTemplate, s)
+	targets, err := s.targets(ctx.Configuration)
+	if err != nil {
+		return err
+	}
+	s.printer, err = s.newPrinter()
+	if err != nil {
+		return err
+	}
+	if len(targets) > 1 {
+		return s.fanOut(ctx.Configuration, targets)
+	}
+	if targets[0].err != nil {
+		return targets[0].err
+	}
+	server, searchParams := targets[0].server, targets[0].searchParams
+	searchParams.Size = s.Limit
+	err = s.fetch(server, searchParams)
+	if err != nil {
+		return err
+	}
+	return s.printer.Flush()
+}
+
+// secretsFunc gets the secret backend servers reference their credentials from.
+type secretsFunc func() (config.SecretBackend, error)
+
+// secretBackendOnce gets the secret backend the first time it is needed only, so the vault passphrase is asked and
+// stdin read at most once per invocation, however many servers are resolved.
+func secretBackendOnce(configuration config.Configuration) secretsFunc {
+	var once sync.Once
+	var backend config.SecretBackend
+	var err error
+	return func() (config.SecretBackend, error) {
+		once.Do(func() {
+			stdin := configuration.GetStdin()
+			backend, err = configuration.GetSecretBackend(askPassphrase(stdin, bufio.NewReader(stdin)))
+		})
+		return backend, err
+	}
+}
+
+// resolveServer gives the server named, or the current one when no name is given, with its secret resolved.
+func resolveServer(configuration config.Configuration, name string, secrets secretsFunc) (config.Server, error) {
+	if strings.Contains(name, nameSeparator) {
+		return config.Server{}, fmt.Errorf("server '%s' is invalid. Only search accepts a comma separated list", name)
+	}
+	server := configuration.GetCurrentServer()
+	if len(name) > 0 {
+		serverArg, ok := configuration.FindServer(name)
+		if !ok {
+			return config.Server{}, fmt.Errorf("server '%s' is invalid", name)
+		}
+		server = serverArg
+	}
+	if len(server.Secret) > 0 {
+		backend, err := secrets()
 		if err != nil {
-			return err
+			return config.Server{}, err
 		}
-		clause = out.String()
+		return config.ResolveSecret(server, backend)
+	}
+	return server, nil
+}
+
+// detectVersion asks elasticsearch servers without a version which one they run, as requests depend on it. The
+// version is not stored: ping --update-version does, saving the round trip on later invocations.
+func detectVersion(server config.Server, httpClient utils.HTTPClient) (config.Server, error) {
+	if server.GetType() != config.ElasticsearchServer || len(server.ElasticsearchVersion) > 0 {
+		return server, nil
+	}
+	version, err := serverVersion(server, httpClient)
+	if err != nil {
+		return config.Server{}, fmt.Errorf("unable to detect the Elasticsearch version: %s. Give it with "+
+			"--es-version or store it with ping --update-version", err)
 	}
+	server.ElasticsearchVersion = version
+	return server, nil
+}
 
-	server := ctx.Configuration.GetCurrentServer()
-	if len(s.Server) > 0 {
-		serverArg, ok := ctx.Configuration.FindServer(s.Server)
+// resolveRole gives the role named, or the current one when no name is given, with the window field overridden when
+// given. The role is transient: it is never written back to the configuration file.
+func resolveRole(configuration config.Configuration, name string, windowField string) (config.Role, error) {
+	if strings.Contains(name, nameSeparator) {
+		return config.Role{}, fmt.Errorf("role '%s' is invalid. Only search accepts a comma separated list", name)
+	}
+	role := configuration.GetCurrentRole()
+	if len(name) > 0 {
+		roleArg, ok := configuration.FindRole(name)
 		if !ok {
-			return fmt.Errorf("server '%s' is invalid", s.Server)
+			return config.Role{}, fmt.Errorf("role '%s' is invalid", name)
 		}
-		server = serverArg
+		role = roleArg
+	}
+	if len(windowField) > 0 {
+		if err := config.ValidateWindowFilter(windowField); err != nil {
+			return config.Role{}, err
+		}
+		role.WindowFilter = windowField
+	}
+	return role, nil
+}
+
+// target resolves which server to query and the search parameters for the query and time window given.
+func (f *FilterFlags) target(configuration config.Configuration) (config.Server, SearchParams, error) {
+	clause, err := f.clause()
+	if err != nil {
+		return config.Server{}, SearchParams{}, err
+	}
+
+	secrets := f.secrets
+	if secrets == nil {
+		secrets = secretBackendOnce(configuration)
+	}
+	server, err := resolveServer(configuration, f.Server, secrets)
+	if err != nil {
+		return config.Server{}, SearchParams{}, err
+	}
+	server, err = detectVersion(server, f.httpClient)
+	if err != nil {
+		return config.Server{}, SearchParams{}, err
+	}
+	role, err := resolveRole(configuration, f.Role, f.WindowField)
+	if err != nil {
+		return config.Server{}, SearchParams{}, err
 	}
-	role := ctx.Configuration.GetCurrentRole()
 
 	currentTime := time.Now()
-	olderTs, err := s.OlderAsTimestamp()
+	olderTs, err := f.OlderAsTimestamp()
 	if err != nil {
-		return err
+		return config.Server{}, SearchParams{}, err
 	}
-	newerTs, err := s.NewerAsTimestamp()
+	newerTs, err := f.NewerAsTimestamp()
 	if err != nil {
-		return err
+		return config.Server{}, SearchParams{}, err
 	}
 	searchParams := SearchParams{
 		Index:        role.Index,
 		Zone:         currentTime.Format("Z07:00"),
 		WindowFilter: role.WindowFilter,
 		Clause:       clause,
-		Size:         s.Limit,
+		Order:        descendingOrder,
 		Older:        olderTs,
 		Newer:        newerTs,
 	}
-	payload, err := buildFromTemplate("payload", payloadTemplate, searchParams)
+	return server, searchParams, nil
+}
+
+// clause gives the query clause out of the query DSL, or matching the query, or every document when there is none.
+func (f *FilterFlags) clause() (string, error) {
+	if len(f.DSLFile) > 0 {
+		content, err := ioutil.ReadFile(f.DSLFile)
+		if err != nil {
+			return "", err
+		}
+		return dslClause(content)
+	}
+	if len(f.DSL) > 0 {
+		return dslClause([]byte(f.DSL))
+	}
+	if len(f.Query) > 1 {
+		return "", errors.New("only msearch accepts --query more than once")
+	}
+	if len(f.Query) <= 0 || len(f.Query[0]) <= 0 {
+		return matchAllClause, nil
+	}
+	return queryStringClause(f.Query[0])
+}
+
+// dslClause checks the query DSL is a JSON object, giving it compacted to a single line.
+func dslClause(dsl []byte) (string, error) {
+	var clause map[string]interface{}
+	if err := json.Unmarshal(dsl, &clause); err != nil {
+		return "", fmt.Errorf("query DSL is invalid. Expected a JSON object, e.g. {\"term\":{\"response\":404}}: %s", err)
+	}
+	if len(clause) <= 0 {
+		return "", errors.New("query DSL is empty. Expected a query clause, e.g. {\"term\":{\"response\":404}}")
+	}
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, dsl); err != nil {
+		return "", err
+	}
+	return compacted.String(), nil
+}
+
+func (s *SearchCmd) newPrinter() (output.Printer, error) {
+	if len(s.TemplateFile) <= 0 && len(s.Template) <= 0 && s.Format == output.TableFormat &&
+		(s.All || s.Scroll || s.MaxDocs > 0) {
+		return nil, errors.New("table format holds every row until the column widths are known, so it can't be " +
+			"used with --all, --scroll or --max-docs. Use csv or tsv instead")
+	}
+	if len(s.TemplateFile) > 0 {
+		content, err := ioutil.ReadFile(s.TemplateFile)
+		if err != nil {
+			return nil, err
+		}
+		return output.NewTemplatePrinter(string(content), os.Stdout)
+	}
+	if len(s.Template) > 0 {
+		return output.NewTemplatePrinter(s.Template, os.Stdout)
+	}
+	return output.New(s.Format, s.Fields, os.Stdout)
+}
+
+func (s *SearchCmd) fetch(server config.Server, searchParams SearchParams) error {
+	if s.Follow {
+		return s.follow(server, searchParams)
+	}
+	if s.Scroll {
+		return s.scroll(server, searchParams)
+	}
+	if s.All || s.MaxDocs > 0 {
+		return s.paginate(server, searchParams)
+	}
+	data, err := s.search(server, searchParams)
 	if err != nil {
 		return err
 	}
-	data, err := s.callApi(server, payload)
+	return data.printAllSources(s.printer)
+}
+
+// paginate keeps fetching pages of documents, until the time window is exhausted or --max-docs documents were
+// printed.
+func (s *SearchCmd) paginate(server config.Server, searchParams SearchParams) error {
+	if s.PageSize <= 0 {
+		return fmt.Errorf("page size must be greater than zero but was %d", s.PageSize)
+	}
+	var fetched int64
+	searchParams.Size = s.pageSize(fetched)
+	return s.pages(server, searchParams, func(hits []map[string]interface{}) (int32, error) {
+		err := printSources(s.printer, hits)
+		if err != nil {
+			return 0, err
+		}
+		fetched += int64(len(hits))
+		if s.MaxDocs > 0 && fetched >= s.MaxDocs {
+			return 0, nil
+		}
+		return s.pageSize(fetched), nil
+	})
+}
+
+// pageSize gives the size of the next page, fetching no more than --max-docs documents overall.
+func (s *SearchCmd) pageSize(fetched int64) int32 {
+	if s.MaxDocs > 0 && s.MaxDocs-fetched < int64(s.PageSize) {
+		return int32(s.MaxDocs - fetched)
+	}
+	return s.PageSize
+}
+
+// pages fetches pages of documents using search_after on the window filter sort value, handing each one to next,
+// which gives the size of the following page or zero to stop. Paging stops as well on the first page holding less
+// documents than asked for.
+// Elasticsearch 8.0 rejects sorting on the document id, so from 7.12 on pages are read from a point in time with
+// _shard_doc as tiebreaker. Older versions use the document id.
+func (s *SearchCmd) pages(server config.Server, searchParams SearchParams,
+	next func(hits []map[string]interface{}) (int32, error)) error {
+	searchParams.Tiebreaker = tiebreakerField
+	if server.VersionAtLeast(7, 12) {
+		pit, err := s.openPointInTime(server, searchParams.Index)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = s.closePointInTime(server, pit)
+		}()
+		searchParams.PointInTime = pit
+		searchParams.Tiebreaker = pitTiebreakerField
+	}
+	for {
+		data, err := s.page(server, searchParams)
+		if err != nil {
+			return err
+		}
+		hits := data.hits()
+		size, err := next(hits)
+		if err != nil {
+			return err
+		}
+		if size <= 0 || len(hits) < int(searchParams.Size) {
+			return nil
+		}
+		if id := data.pointInTimeID(); searchParams.PointInTime != nil && len(id) > 0 {
+			searchParams.PointInTime.ID = id
+		}
+		searchParams.Size = size
+		searchParams.SearchAfter, err = searchAfter(hits)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// page fetches a page of documents. Searches reading from a point in time can't name the index, it is given by the
+// point in time already.
+func (s *SearchCmd) page(server config.Server, searchParams SearchParams) (*ResponseData, error) {
+	if searchParams.PointInTime == nil {
+		return s.search(server, searchParams)
+	}
+	body, err := buildBody(searchParams.searchBody())
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.call(server, "POST", pitSearchPath, body)
+	if err != nil {
+		return nil, err
+	}
+	return data, data.failure()
+}
+
+// openPointInTime opens a point in time over the index, kept alive for --keep-alive between pages.
+func (s *SearchCmd) openPointInTime(server config.Server, index string) (*pointInTime, error) {
+	path := fmt.Sprintf("/%s%s?keep_alive=%s&ignore_unavailable=true", index, pitPath, url.QueryEscape(s.KeepAlive))
+	data, err := s.call(server, "POST", path, bytes.Buffer{})
+	if err != nil {
+		return nil, err
+	}
+	if err := data.failure(); err != nil {
+		return nil, err
+	}
+	id, ok := data.Payload["id"].(string)
+	if !ok {
+		return nil, errors.New("unable to find the point in time id in the response")
+	}
+	return &pointInTime{ID: id, KeepAlive: s.KeepAlive}, nil
+}
+
+func (s *SearchCmd) closePointInTime(server config.Server, pit *pointInTime) error {
+	body, err := buildBody(closePointInTimeRequest{ID: pit.ID})
 	if err != nil {
 		return err
 	}
-	err = data.printAllSources()
+	_, err = s.call(server, "DELETE", pitPath, body)
+	return err
+}
+
+// searchAfter gives the sort values of the last hit, to fetch the documents coming right after it.
+func searchAfter(hits []map[string]interface{}) (string, error) {
+	sortValues, ok := hits[len(hits)-1]["sort"]
+	if !ok {
+		return "", errors.New("unable to paginate: last hit has no sort values")
+	}
+	asJSON, err := json.Marshal(sortValues)
+	if err != nil {
+		return "", err
+	}
+	return string(asJSON), nil
+}
+
+// followState tracks the newest window filter value printed so far and which documents were printed with it.
+type followState struct {
+	newest int64
+	seen   map[string]bool
+}
+
+// follow prints the latest documents then polls for new ones every --interval, until kishell gets interrupted.
+// Each poll starts from the newest window filter value printed so far, skipping documents already printed.
+func (s *SearchCmd) follow(server config.Server, searchParams SearchParams) error {
+	if s.Interval <= 0 {
+		return fmt.Errorf("interval must be greater than zero but was %s", s.Interval)
+	}
+	if s.PageSize <= 0 {
+		return fmt.Errorf("page size must be greater than zero but was %d", s.PageSize)
+	}
+	data, err := s.search(server, searchParams)
 	if err != nil {
 		return err
 	}
+	hits := data.hits()
+	for i, j := 0, len(hits)-1; i < j; i, j = i+1, j-1 {
+		hits[i], hits[j] = hits[j], hits[i]
+	}
+	state := &followState{
+		newest: searchParams.Newer,
+		seen:   map[string]bool{},
+	}
+	for {
+		err = s.printNew(state, hits)
+		if err != nil {
+			return err
+		}
+		err = s.printer.Flush()
+		if err != nil {
+			return err
+		}
+		time.Sleep(s.Interval)
+		hits, err = s.poll(server, searchParams, state)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// poll fetches every document from the newest window filter value printed so far up to now, in chronological order.
+func (s *SearchCmd) poll(server config.Server, searchParams SearchParams, state *followState) ([]map[string]interface{}, error) {
+	older, err := toTimestamp(nowAnchor, true)
+	if err != nil {
+		return nil, err
+	}
+	searchParams.Newer = state.newest
+	searchParams.Older = older
+	searchParams.Order = ascendingOrder
+	searchParams.Size = s.PageSize
+	var hits []map[string]interface{}
+	err = s.pages(server, searchParams, func(page []map[string]interface{}) (int32, error) {
+		hits = append(hits, page...)
+		return s.PageSize, nil
+	})
+	return hits, err
+}
+
+// printNew prints the hits not printed yet, given they are in chronological order.
+func (s *SearchCmd) printNew(state *followState, hits []map[string]interface{}) error {
+	for _, hit := range hits {
+		timestamp, err := sortTimestamp(hit)
+		if err != nil {
+			return err
+		}
+		id, _ := hit["_id"].(string)
+		if timestamp < state.newest || (timestamp == state.newest && state.seen[id]) {
+			continue
+		}
+		if timestamp > state.newest {
+			state.newest = timestamp
+			state.seen = map[string]bool{}
+		}
+		state.seen[id] = true
+		err = s.printer.Print(hit)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (s *SearchCmd) callApi(server config.Server, payload bytes.Buffer) (*ResponseData, error) {
-	url := fmt.Sprintf("%s://%s:%s%s", server.Protocol, server.Hostname, server.GetPort(), esSearchPath)
+// sortTimestamp gives the window filter value of the hit as epoch millis, taken from its first sort value.
+func sortTimestamp(hit map[string]interface{}) (int64, error) {
+	sortValues, _ := hit["sort"].([]interface{})
+	if len(sortValues) <= 0 {
+		return 0, errors.New("unable to follow: hit has no sort values")
+	}
+	switch value := sortValues[0].(type) {
+	case json.Number:
+		return value.Int64()
+	case float64:
+		return int64(value), nil
+	}
+	return 0, fmt.Errorf("unable to follow: window filter value %v is not a date", sortValues[0])
+}
+
+// scroll walks through every document within the time window using the scroll API, for clusters rejecting
+// search_after. The scroll context is cleared once done, on failures and when kishell gets interrupted.
+func (s *SearchCmd) scroll(server config.Server, searchParams SearchParams) error {
+	if s.PageSize <= 0 {
+		return fmt.Errorf("page size must be greater than zero but was %d", s.PageSize)
+	}
+	var lock sync.Mutex
+	scrollParams := ScrollParams{KeepAlive: s.KeepAlive}
+	clearScroll := func() {
+		lock.Lock()
+		defer lock.Unlock()
+		if len(scrollParams.ScrollID) > 0 {
+			_ = s.clearScroll(server, scrollParams)
+			scrollParams.ScrollID = ""
+		}
+	}
+	stop := onInterrupt(clearScroll)
+	defer stop()
+	defer clearScroll()
 
-	request, err := s.httpClient.NewRequest("POST", url, &payload)
+	searchParams.Size = s.PageSize
+	body, err := buildBody(searchParams.searchBody())
 	if err != nil {
-		return nil, err
+		return err
 	}
-	request.Header.Add(headers.ContentType, postContentType)
-	request.Header.Add(kibanaVersionHeaderKey, server.KibanaVersion)
-	if len(server.BasicAuth) > 0 {
-		request.Header.Add(headers.Authorization, fmt.Sprintf("%s %s", "Basic", server.BasicAuth))
+	path := fmt.Sprintf("/%s/_search?scroll=%s", searchParams.Index, url.QueryEscape(s.KeepAlive))
+	data, err := s.call(server, "POST", path, body)
+	var fetched int64
+	for {
+		if err != nil {
+			return err
+		}
+		lock.Lock()
+		scrollParams.ScrollID = data.scrollID()
+		lock.Unlock()
+
+		hits := data.hits()
+		if s.MaxDocs > 0 && int64(len(hits)) > s.MaxDocs-fetched {
+			hits = hits[:s.MaxDocs-fetched]
+		}
+		err = printSources(s.printer, hits)
+		if err != nil {
+			return err
+		}
+		fetched += int64(len(hits))
+		if len(hits) <= 0 || (s.MaxDocs > 0 && fetched >= s.MaxDocs) {
+			return nil
+		}
+		body, err = buildBody(scrollParams)
+		if err != nil {
+			return err
+		}
+		data, err = s.call(server, "POST", scrollPath, body)
 	}
+}
 
-	response, err := s.httpClient.Call(request)
+func (s *SearchCmd) clearScroll(server config.Server, scrollParams ScrollParams) error {
+	body, err := buildBody(clearScrollRequest{ScrollID: []string{scrollParams.ScrollID}})
+	if err != nil {
+		return err
+	}
+	_, err = s.call(server, "DELETE", scrollPath, body)
+	return err
+}
+
+func (f *FilterFlags) search(server config.Server, searchParams SearchParams) (*ResponseData, error) {
+	body, err := buildBody(searchParams.searchBody())
 	if err != nil {
 		return nil, err
 	}
-	defer response.Body.Close()
-	return parseResponse(response)
+	data, err := f.callApi(server, searchParams.Index, body)
+	if err != nil {
+		return nil, err
+	}
+	return data, data.failure()
 }
 
 func parseResponse(response *http.Response) (*ResponseData, error) {
 	contentType, _, err := mime.ParseMediaType(response.Header.Get(headers.ContentType))
 	if err != nil {
-	    return nil, err
-    }
-	if contentType == "application/json" {
+		return nil, err
+	}
+	if contentType == jsonContentType {
 		if response.StatusCode < 400 {
 			var result map[string]interface{}
-			err = json.NewDecoder(response.Body).Decode(&result)
+			decoder := json.NewDecoder(response.Body)
+			decoder.UseNumber()
+			err = decoder.Decode(&result)
 			if err != nil {
 				return nil, err
 			}
@@ -162,18 +683,11 @@ func parseResponse(response *http.Response) (*ResponseData, error) {
 			responseData.Payload = result
 			return responseData, nil
 		}
-        buffer := new(bytes.Buffer)
-        buffer.ReadFrom(response.Body)
-        responseBody := buffer.String()
-        return nil, fmt.Errorf("unable to communicate with server - %s", responseBody)
+		buffer := new(bytes.Buffer)
+		buffer.ReadFrom(response.Body)
+		responseBody := buffer.String()
+		return nil, fmt.Errorf("unable to communicate with server - %s", responseBody)
 	}
 
 	return nil, fmt.Errorf("invalid content type: %s", contentType)
 }
-
-func buildFromTemplate(name string, templateObj string, data interface{}) (bytes.Buffer, error) {
-	queryTemplate, _ := template.New(name).Parse(templateObj)
-	var out bytes.Buffer
-	err := queryTemplate.Execute(&out, data)
-	return out, err
-}
@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"github.com/go-http-utils/headers"
 	"github.com/sidilabs/kishell/pkg/config"
+	"github.com/sidilabs/kishell/pkg/output"
 	"github.com/stretchr/testify/mock"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"strings"
 	"testing"
 )
 
@@ -83,10 +86,12 @@ func testIt(t *testing.T, source string, response *http.Response) error {
 	}
 
 	cmd := SearchCmd{
-		Server:     serverName,
-		Limit:      30,
-		httpClient: httpClient,
-		Older:      "30m",
+		FilterFlags: FilterFlags{
+			Server:     serverName,
+			Older:      "30m",
+			httpClient: httpClient,
+		},
+		Limit: 30,
 	}
 
 	err := cmd.Run(&context)
@@ -94,3 +99,437 @@ func testIt(t *testing.T, source string, response *http.Response) error {
 	httpClient.AssertExpectations(t)
 	return err
 }
+
+func TestPaginateWithSearchAfter(t *testing.T) {
+	configuration := new(ConfigurationMock)
+	configuration.On("CheckEmpty").Return(nil)
+	configuration.On("GetCurrentServer").Return(config.Server{Protocol: "http", Hostname: "ut.server"})
+	configuration.On("GetCurrentRole").Return(config.Role{Index: "ut-*", WindowFilter: "@timestamp"})
+
+	firstPage := jsonResponse(`{ "responses": [ { "hits": { "hits": [
+		{ "_id": "a", "_source": {"n": 1}, "sort": [1609459200002, "a"] },
+		{ "_id": "b", "_source": {"n": 2}, "sort": [1609459200001, "b"] } ] } } ] }`)
+	lastPage := jsonResponse(`{ "responses": [ { "hits": { "hits": [
+		{ "_id": "c", "_source": {"n": 3}, "sort": [1609459200000, "c"] } ] } } ] }`)
+
+	httpClient := new(MockHttpClient)
+	httpClient.Request = http.Request{
+		Header: map[string][]string{},
+	}
+	firstPayload := mock.MatchedBy(func(body *bytes.Buffer) bool {
+		return !strings.Contains(body.String(), "search_after")
+	})
+	nextPayload := mock.MatchedBy(func(body *bytes.Buffer) bool {
+		return strings.Contains(body.String(), `"search_after":[1609459200001,"b"]`) &&
+			strings.Contains(body.String(), `{"_id":{"order":"desc"}}`)
+	})
+	httpClient.On("NewRequest", "POST", mock.Anything, firstPayload).Return(&httpClient.Request, nil).Once()
+	httpClient.On("NewRequest", "POST", mock.Anything, nextPayload).Return(&httpClient.Request, nil).Once()
+	httpClient.On("Call", &httpClient.Request).Return(firstPage, nil).Once()
+	httpClient.On("Call", &httpClient.Request).Return(lastPage, nil).Once()
+
+	context := Context{
+		Debug:         true,
+		Configuration: configuration,
+	}
+	cmd := SearchCmd{
+		All:         true,
+		PageSize:    2,
+		FilterFlags: FilterFlags{httpClient: httpClient},
+	}
+
+	err := cmd.Run(&context)
+	if err != nil {
+		t.Fatal("Paginating over documents must succeed", err)
+	}
+	configuration.AssertExpectations(t)
+	httpClient.AssertExpectations(t)
+}
+
+func TestPaginateStopsAtMaxDocs(t *testing.T) {
+	configuration := new(ConfigurationMock)
+	configuration.On("CheckEmpty").Return(nil)
+	configuration.On("GetCurrentServer").Return(config.Server{Protocol: "http", Hostname: "ut.server"})
+	configuration.On("GetCurrentRole").Return(config.Role{Index: "ut-*", WindowFilter: "@timestamp"})
+
+	page := jsonResponse(`{ "responses": [ { "hits": { "hits": [
+		{ "_id": "a", "_source": {"n": 1}, "sort": [1609459200002, "a"] } ] } } ] }`)
+
+	httpClient := new(MockHttpClient)
+	httpClient.Request = http.Request{
+		Header: map[string][]string{},
+	}
+	sizeOne := mock.MatchedBy(func(body *bytes.Buffer) bool {
+		return strings.Contains(body.String(), `"size":1,`)
+	})
+	httpClient.On("NewRequest", "POST", mock.Anything, sizeOne).Return(&httpClient.Request, nil).Once()
+	httpClient.On("Call", &httpClient.Request).Return(page, nil).Once()
+
+	context := Context{
+		Debug:         true,
+		Configuration: configuration,
+	}
+	cmd := SearchCmd{
+		MaxDocs:     1,
+		PageSize:    1000,
+		FilterFlags: FilterFlags{httpClient: httpClient},
+	}
+
+	err := cmd.Run(&context)
+	if err != nil {
+		t.Fatal("Paginating over documents must succeed", err)
+	}
+	httpClient.AssertExpectations(t)
+}
+
+func TestPaginateWithPointInTime(t *testing.T) {
+	configuration := new(ConfigurationMock)
+	configuration.On("CheckEmpty").Return(nil)
+	configuration.On("GetCurrentServer").Return(config.Server{Type: config.ElasticsearchServer, Protocol: "http",
+		Hostname: "es.ut", ElasticsearchVersion: "8.11.0"})
+	configuration.On("GetCurrentRole").Return(config.Role{Index: "ut-*", WindowFilter: "@timestamp"})
+
+	opened := jsonResponse(`{ "id": "ut-pit-1" }`)
+	firstPage := jsonResponse(`{ "pit_id": "ut-pit-2", "hits": { "hits": [
+		{ "_id": "a", "_source": {"n": 1}, "sort": [1609459200002, 7] },
+		{ "_id": "b", "_source": {"n": 2}, "sort": [1609459200001, 3] } ] } }`)
+	lastPage := jsonResponse(`{ "pit_id": "ut-pit-2", "hits": { "hits": [
+		{ "_id": "c", "_source": {"n": 3}, "sort": [1609459200000, 5] } ] } }`)
+	closed := jsonResponse(`{ "succeeded": true, "num_freed": 1 }`)
+
+	httpClient := new(MockHttpClient)
+	httpClient.Request = http.Request{
+		Header: map[string][]string{},
+	}
+	firstPayload := mock.MatchedBy(func(body *bytes.Buffer) bool {
+		return strings.Contains(body.String(), `"pit":{"id":"ut-pit-1","keep_alive":"2m"}`) &&
+			strings.Contains(body.String(), `{"_shard_doc":{"order":"desc"}}`) &&
+			!strings.Contains(body.String(), "search_after")
+	})
+	nextPayload := mock.MatchedBy(func(body *bytes.Buffer) bool {
+		return strings.Contains(body.String(), `"pit":{"id":"ut-pit-2","keep_alive":"2m"}`) &&
+			strings.Contains(body.String(), `"search_after":[1609459200001,3]`)
+	})
+	closePayload := mock.MatchedBy(func(body *bytes.Buffer) bool {
+		return body.String() == `{"id":"ut-pit-2"}`
+	})
+	httpClient.On("NewRequest", "POST", "http://es.ut:9200/ut-*/_pit?keep_alive=2m&ignore_unavailable=true",
+		mock.Anything).Return(&httpClient.Request, nil).Once()
+	httpClient.On("NewRequest", "POST", "http://es.ut:9200/_search", firstPayload).Return(&httpClient.Request, nil).Once()
+	httpClient.On("NewRequest", "POST", "http://es.ut:9200/_search", nextPayload).Return(&httpClient.Request, nil).Once()
+	httpClient.On("NewRequest", "DELETE", "http://es.ut:9200/_pit", closePayload).Return(&httpClient.Request, nil).Once()
+	httpClient.On("Call", &httpClient.Request).Return(opened, nil).Once()
+	httpClient.On("Call", &httpClient.Request).Return(firstPage, nil).Once()
+	httpClient.On("Call", &httpClient.Request).Return(lastPage, nil).Once()
+	httpClient.On("Call", &httpClient.Request).Return(closed, nil).Once()
+
+	var out bytes.Buffer
+	printer, _ := output.New(output.JSONFormat, nil, &out)
+	cmd := SearchCmd{
+		All:         true,
+		PageSize:    2,
+		KeepAlive:   "2m",
+		FilterFlags: FilterFlags{Older: "now", Newer: "15m", httpClient: httpClient},
+		printer:     printer,
+	}
+	server, searchParams, err := cmd.target(configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cmd.paginate(server, searchParams)
+	if err != nil {
+		t.Fatal("Paginating over a point in time must succeed", err)
+	}
+	if out.String() != "{\"n\":1}\n{\"n\":2}\n{\"n\":3}\n" {
+		t.Fatalf("Every page must be printed but was %q", out.String())
+	}
+	httpClient.AssertExpectations(t)
+}
+
+func TestMaxDocsWithoutStoredVersion(t *testing.T) {
+	configuration := new(ConfigurationMock)
+	configuration.On("CheckEmpty").Return(nil)
+	configuration.On("GetCurrentServer").Return(config.Server{Type: config.ElasticsearchServer, Protocol: "http",
+		Hostname: "es.ut"})
+	configuration.On("GetCurrentRole").Return(config.Role{Index: "ut-*", WindowFilter: "@timestamp"})
+
+	httpClient := new(MockHttpClient)
+	httpClient.Request = http.Request{
+		Header: map[string][]string{},
+	}
+	pagePayload := mock.MatchedBy(func(body *bytes.Buffer) bool {
+		return strings.Contains(body.String(), `"pit":{"id":"ut-pit-1","keep_alive":"1m"}`) &&
+			strings.Contains(body.String(), `{"_shard_doc":{"order":"desc"}}`) &&
+			!strings.Contains(body.String(), `"_id"`)
+	})
+	httpClient.On("NewRequest", "GET", "http://es.ut:9200/", mock.Anything).Return(&httpClient.Request, nil).Once()
+	httpClient.On("NewRequest", "POST", "http://es.ut:9200/ut-*/_pit?keep_alive=1m&ignore_unavailable=true",
+		mock.Anything).Return(&httpClient.Request, nil).Once()
+	httpClient.On("NewRequest", "POST", "http://es.ut:9200/_search", pagePayload).Return(&httpClient.Request, nil).Once()
+	httpClient.On("NewRequest", "DELETE", "http://es.ut:9200/_pit", mock.Anything).Return(&httpClient.Request, nil).Once()
+	httpClient.On("Call", &httpClient.Request).Return(jsonResponse(`{ "version": { "number": "8.11.1" } }`), nil).Once()
+	httpClient.On("Call", &httpClient.Request).Return(jsonResponse(`{ "id": "ut-pit-1" }`), nil).Once()
+	httpClient.On("Call", &httpClient.Request).Return(jsonResponse(`{ "pit_id": "ut-pit-1", "hits": { "hits": [
+		{ "_id": "a", "_source": {"n": 1}, "sort": [1609459200000, 7] } ] } }`), nil).Once()
+	httpClient.On("Call", &httpClient.Request).Return(jsonResponse(`{ "succeeded": true }`), nil).Once()
+
+	var out bytes.Buffer
+	printer, _ := output.New(output.JSONFormat, nil, &out)
+	cmd := SearchCmd{
+		MaxDocs:     1,
+		PageSize:    1000,
+		KeepAlive:   "1m",
+		FilterFlags: FilterFlags{Older: "now", Newer: "15m", httpClient: httpClient},
+		printer:     printer,
+	}
+	server, searchParams, err := cmd.target(configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cmd.paginate(server, searchParams)
+	if err != nil {
+		t.Fatal("Elasticsearch servers without a stored version must paginate over a point in time", err)
+	}
+	if out.String() != "{\"n\":1}\n" {
+		t.Fatalf("Unexpected output %q", out.String())
+	}
+	httpClient.AssertExpectations(t)
+}
+
+func TestTableRefusedWhenPaginating(t *testing.T) {
+	for _, cmd := range []SearchCmd{
+		{Format: output.TableFormat, All: true},
+		{Format: output.TableFormat, Scroll: true},
+		{Format: output.TableFormat, MaxDocs: 5000},
+	} {
+		if _, err := cmd.newPrinter(); err == nil {
+			t.Errorf("Table format must be refused with %+v", cmd)
+		}
+	}
+	cmd := SearchCmd{Format: output.TableFormat, All: true, Template: "{{._id}}"}
+	if _, err := cmd.newPrinter(); err != nil {
+		t.Error("Templates must be allowed when paginating", err)
+	}
+}
+
+func jsonResponse(body string) *http.Response {
+	return &http.Response{
+		Header: http.Header{
+			headers.ContentType: []string{"application/json"},
+		},
+		StatusCode: 200,
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func TestScrollThroughEveryBatch(t *testing.T) {
+	configuration := new(ConfigurationMock)
+	configuration.On("CheckEmpty").Return(nil)
+	configuration.On("GetCurrentServer").Return(config.Server{Protocol: "http", Hostname: "ut.server"})
+	configuration.On("GetCurrentRole").Return(config.Role{Index: "ut-*", WindowFilter: "@timestamp"})
+
+	firstBatch := jsonResponse(`{ "_scroll_id": "ut-scroll", "hits": { "hits": [
+		{ "_id": "a", "_source": {"n": 1} }, { "_id": "b", "_source": {"n": 2} } ] } }`)
+	lastBatch := jsonResponse(`{ "_scroll_id": "ut-scroll", "hits": { "hits": [] } }`)
+	cleared := jsonResponse(`{ "succeeded": true, "num_freed": 1 }`)
+
+	httpClient := new(MockHttpClient)
+	httpClient.Request = http.Request{
+		Header: map[string][]string{},
+	}
+	openURL := "http://ut.server:80/api/console/proxy?method=POST&path=%2Fut-%2A%2F_search%3Fscroll%3D2m"
+	scrollURL := "http://ut.server:80/api/console/proxy?method=POST&path=%2F_search%2Fscroll"
+	clearURL := "http://ut.server:80/api/console/proxy?method=DELETE&path=%2F_search%2Fscroll"
+	scrollPayload := mock.MatchedBy(func(body *bytes.Buffer) bool {
+		return body.String() == `{"scroll":"2m","scroll_id":"ut-scroll"}`
+	})
+	clearPayload := mock.MatchedBy(func(body *bytes.Buffer) bool {
+		return body.String() == `{"scroll_id":["ut-scroll"]}`
+	})
+	httpClient.On("NewRequest", "POST", openURL, mock.Anything).Return(&httpClient.Request, nil).Once()
+	httpClient.On("NewRequest", "POST", scrollURL, scrollPayload).Return(&httpClient.Request, nil).Once()
+	httpClient.On("NewRequest", "POST", clearURL, clearPayload).Return(&httpClient.Request, nil).Once()
+	httpClient.On("Call", &httpClient.Request).Return(firstBatch, nil).Once()
+	httpClient.On("Call", &httpClient.Request).Return(lastBatch, nil).Once()
+	httpClient.On("Call", &httpClient.Request).Return(cleared, nil).Once()
+
+	context := Context{
+		Debug:         true,
+		Configuration: configuration,
+	}
+	cmd := SearchCmd{
+		Scroll:      true,
+		KeepAlive:   "2m",
+		PageSize:    2,
+		FilterFlags: FilterFlags{httpClient: httpClient},
+	}
+
+	err := cmd.Run(&context)
+	if err != nil {
+		t.Fatal("Scrolling over documents must succeed", err)
+	}
+	httpClient.AssertExpectations(t)
+}
+
+func TestFollowSkipsDocumentsAlreadyPrinted(t *testing.T) {
+	page := jsonResponse(`{ "responses": [ { "hits": { "hits": [
+		{ "_id": "a", "_source": {"n": 1}, "sort": [1000, "a"] },
+		{ "_id": "b", "_source": {"n": 2}, "sort": [1000, "b"] },
+		{ "_id": "c", "_source": {"n": 3}, "sort": [2000, "c"] } ] } } ] }`)
+
+	httpClient := new(MockHttpClient)
+	httpClient.Request = http.Request{
+		Header: map[string][]string{},
+	}
+	ascendingPayload := mock.MatchedBy(func(body *bytes.Buffer) bool {
+		return strings.Contains(body.String(), `"sort":[{"@timestamp":{"order":"asc","unmapped_type":"boolean"}},{"_id":{"order":"asc"}}]`) &&
+			strings.Contains(body.String(), `"gte":1000,`)
+	})
+	httpClient.On("NewRequest", "POST", mock.Anything, ascendingPayload).Return(&httpClient.Request, nil).Once()
+	httpClient.On("Call", &httpClient.Request).Return(page, nil).Once()
+
+	var out bytes.Buffer
+	printer, _ := output.New(output.JSONFormat, nil, &out)
+	cmd := SearchCmd{
+		PageSize:    10,
+		FilterFlags: FilterFlags{httpClient: httpClient},
+		printer:     printer,
+	}
+	state := &followState{
+		newest: 1000,
+		seen:   map[string]bool{"a": true},
+	}
+	searchParams := SearchParams{
+		WindowFilter: "@timestamp",
+		Clause:       matchAllClause,
+		Order:        descendingOrder,
+	}
+
+	hits, err := cmd.poll(config.Server{Protocol: "http", Hostname: "ut.server"}, searchParams, state)
+	if err != nil {
+		t.Fatal("Polling for new documents must succeed", err)
+	}
+	err = cmd.printNew(state, hits)
+	if err != nil {
+		t.Fatal("Printing new documents must succeed", err)
+	}
+	if out.String() != "{\"n\":2}\n{\"n\":3}\n" {
+		t.Fatalf("Only new documents must be printed but was %q", out.String())
+	}
+	if state.newest != 2000 || !state.seen["c"] || state.seen["a"] {
+		t.Fatalf("Follow state must move to the newest document but was %v", state)
+	}
+	httpClient.AssertExpectations(t)
+}
+
+func TestTargetResolvesSecret(t *testing.T) {
+	configuration := new(ConfigurationMock)
+	configuration.On("GetCurrentServer").Return(config.Server{
+		Protocol: "http",
+		Hostname: "ut.server",
+		AuthType: config.APIKeyAuth,
+		Secret:   "ut-secret",
+	})
+	configuration.On("GetStdin").Return(&bytes.Buffer{})
+	configuration.On("GetSecretBackend", mock.Anything).Return(memorySecrets{"ut-secret": "aWQ6a2V5"}, nil)
+	configuration.On("GetCurrentRole").Return(config.Role{})
+
+	filterFlags := FilterFlags{Older: "now", Newer: "15m"}
+	server, _, err := filterFlags.target(configuration)
+	if err != nil {
+		t.Fatal("Resolving the server secret must succeed", err)
+	}
+	if authorization := server.Authorization(); authorization != "ApiKey aWQ6a2V5" {
+		t.Errorf("Unexpected authorization %s", authorization)
+	}
+	configuration.AssertExpectations(t)
+}
+
+func TestTargetWithTransientRole(t *testing.T) {
+	stored := new(ConfigurationMock)
+	stored.On("GetCurrentServer").Return(config.Server{Protocol: "http", Hostname: "ut.server"})
+	stored.On("GetCurrentRole").Return(config.Role{Index: "ut-*", WindowFilter: "@timestamp"})
+	stored.On("FindRole", "audit").Return(config.Role{Index: "audit-*", WindowFilter: "@timestamp"}, true)
+	stored.On("FindRole", mock.Anything).Return(config.Role{}, false)
+	configuration, err := config.WithOverrides(stored, config.Overrides{WindowFilter: "event.created"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filterFlags := FilterFlags{Older: "now", Newer: "15m", Role: "audit"}
+	_, searchParams, err := filterFlags.target(configuration)
+	if err != nil {
+		t.Fatal("Resolving a transient role must succeed", err)
+	}
+	if searchParams.Index != "audit-*" || searchParams.WindowFilter != "event.created" {
+		t.Errorf("Unexpected search params %+v", searchParams)
+	}
+	stored.AssertNotCalled(t, "AddRole", mock.Anything, mock.Anything)
+	stored.AssertNotCalled(t, "Save")
+
+	filterFlags.WindowField = "event.ingested"
+	_, searchParams, err = filterFlags.target(configuration)
+	if err != nil || searchParams.WindowFilter != "event.ingested" {
+		t.Errorf("Window field must override the role window filter, got %+v %v", searchParams, err)
+	}
+
+	filterFlags.WindowField = "  "
+	if _, _, err := filterFlags.target(configuration); err == nil {
+		t.Error("Invalid window fields must be reported")
+	}
+
+	filterFlags.WindowField = ""
+	filterFlags.Role = "missing"
+	if _, _, err := filterFlags.target(configuration); err == nil {
+		t.Error("Unknown roles must be reported")
+	}
+}
+
+func TestDSLReplacesQueryClause(t *testing.T) {
+	configuration := new(ConfigurationMock)
+	configuration.On("GetCurrentServer").Return(config.Server{Protocol: "http", Hostname: "ut.server"})
+	configuration.On("GetCurrentRole").Return(config.Role{Index: "ut-*", WindowFilter: "@timestamp"})
+
+	filterFlags := FilterFlags{
+		Older: "now",
+		Newer: "15m",
+		DSL:   "{\n  \"bool\": { \"filter\": [ { \"terms\": { \"response\": [404, 500] } } ] }\n}",
+	}
+	_, searchParams, err := filterFlags.target(configuration)
+	if err != nil {
+		t.Fatal("Query DSL must be accepted", err)
+	}
+	body, err := buildBody(searchParams.searchBody())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `"query":{"bool":{"must":[{"bool":{"filter":[{"terms":{"response":[404,500]}}]}},{"range":{"@timestamp":`
+	if !strings.Contains(body.String(), expected) {
+		t.Errorf("Query DSL must be compacted and filtered by the time window, got %s", body.String())
+	}
+}
+
+func TestDSLFile(t *testing.T) {
+	file, err := ioutil.TempFile("", "kishell-dsl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString(`{ "exists": { "field": "error.stack_trace" } }`)
+	file.Close()
+
+	filterFlags := FilterFlags{DSLFile: file.Name()}
+	clause, err := filterFlags.clause()
+	if err != nil || clause != `{"exists":{"field":"error.stack_trace"}}` {
+		t.Errorf("Unexpected clause %s %v", clause, err)
+	}
+}
+
+func TestInvalidDSL(t *testing.T) {
+	for _, dsl := range []string{`{"term":`, `[{"term":{"response":404}}]`, `"response:404"`, `{}`, `{"term":{}} {}`} {
+		filterFlags := FilterFlags{DSL: dsl}
+		if _, err := filterFlags.clause(); err == nil {
+			t.Errorf("Expected query DSL %s to be invalid", dsl)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package options
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	nowAnchor       = "now"
+	dateMathAnchor  = "||"
+	millisPerSecond = int64(time.Second / time.Millisecond)
+)
+
+var (
+	durationPattern     = regexp.MustCompile(`^(\d+(\.\d+)?(ns|us|µs|ms|s|m|h|d|w))+$`)
+	durationPartPattern = regexp.MustCompile(`(\d+(?:\.\d+)?)(ns|us|µs|ms|s|m|h|d|w)`)
+	dateMathPattern     = regexp.MustCompile(`^(?:([+-])(\d+)([yMwdhHms])|/([yMwdhHms]))`)
+	epochMillisPattern  = regexp.MustCompile(`^\d+$`)
+	dateLayouts         = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"}
+)
+
+// toTimestamp converts a time expression into epoch millis. The expression is one of:
+//   - a duration relative to now, e.g. 15m, 1h30m, 7d or 2w;
+//   - an RFC 3339 timestamp or date, e.g. 2021-01-02T03:00:00Z or 2021-01-02. Local time is assumed without zone;
+//   - epoch millis, e.g. 1609556400000;
+//   - Elasticsearch date math anchored at now or at a date followed by ||, e.g. now-1d/d or 2021-01-02||+1M/M.
+//
+// Rounding goes to the end of the unit when roundUp is set, like Elasticsearch does for upper bounds.
+func toTimestamp(expression string, roundUp bool) (int64, error) {
+	return parseTimestamp(expression, time.Now(), roundUp)
+}
+
+func parseTimestamp(expression string, now time.Time, roundUp bool) (int64, error) {
+	expression = strings.TrimSpace(expression)
+	if len(expression) <= 0 {
+		return toMillis(now), nil
+	}
+	if durationPattern.MatchString(expression) {
+		duration, err := parseDuration(expression)
+		if err != nil {
+			return -1, err
+		}
+		return toMillis(now.Add(-duration)), nil
+	}
+	anchor := now
+	math := ""
+	if strings.HasPrefix(expression, nowAnchor) {
+		math = expression[len(nowAnchor):]
+	} else {
+		date := expression
+		if i := strings.Index(expression, dateMathAnchor); i >= 0 {
+			date = expression[:i]
+			math = expression[i+len(dateMathAnchor):]
+		}
+		parsed, err := parseDate(date)
+		if err != nil {
+			return -1, err
+		}
+		anchor = parsed
+	}
+	result, err := applyDateMath(anchor, math, roundUp)
+	if err != nil {
+		return -1, fmt.Errorf("invalid time expression '%s': %s", expression, err)
+	}
+	return toMillis(result), nil
+}
+
+// parseDuration parses durations like time.ParseDuration does, also accepting days (d) and weeks (w).
+func parseDuration(expression string) (time.Duration, error) {
+	var total time.Duration
+	for _, part := range durationPartPattern.FindAllStringSubmatch(expression, -1) {
+		switch part[2] {
+		case "d", "w":
+			value, err := strconv.ParseFloat(part[1], 64)
+			if err != nil {
+				return 0, err
+			}
+			days := value
+			if part[2] == "w" {
+				days *= 7
+			}
+			total += time.Duration(days * float64(24*time.Hour))
+		default:
+			duration, err := time.ParseDuration(part[0])
+			if err != nil {
+				return 0, err
+			}
+			total += duration
+		}
+	}
+	return total, nil
+}
+
+func parseDate(expression string) (time.Time, error) {
+	if epochMillisPattern.MatchString(expression) {
+		millis, err := strconv.ParseInt(expression, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(millis/millisPerSecond, (millis%millisPerSecond)*int64(time.Millisecond)), nil
+	}
+	for _, layout := range dateLayouts {
+		date, err := time.ParseInLocation(layout, expression, time.Local)
+		if err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time expression '%s'. Expected a duration, a RFC 3339 timestamp, "+
+		"epoch millis or date math", expression)
+}
+
+// applyDateMath adds, subtracts and rounds the anchor date through operations like -1d, +2h or /d.
+func applyDateMath(anchor time.Time, math string, roundUp bool) (time.Time, error) {
+	date := anchor
+	for len(math) > 0 {
+		operation := dateMathPattern.FindStringSubmatch(math)
+		if operation == nil {
+			return date, fmt.Errorf("unexpected date math '%s'", math)
+		}
+		math = math[len(operation[0]):]
+		if len(operation[4]) > 0 {
+			date = roundDate(date, operation[4], roundUp)
+			continue
+		}
+		amount, err := strconv.Atoi(operation[2])
+		if err != nil {
+			return date, err
+		}
+		if operation[1] == "-" {
+			amount = -amount
+		}
+		date = addToDate(date, amount, operation[3])
+	}
+	return date, nil
+}
+
+func addToDate(date time.Time, amount int, unit string) time.Time {
+	switch unit {
+	case "y":
+		return date.AddDate(amount, 0, 0)
+	case "M":
+		return date.AddDate(0, amount, 0)
+	case "w":
+		return date.AddDate(0, 0, 7*amount)
+	case "d":
+		return date.AddDate(0, 0, amount)
+	case "h", "H":
+		return date.Add(time.Duration(amount) * time.Hour)
+	case "m":
+		return date.Add(time.Duration(amount) * time.Minute)
+	}
+	return date.Add(time.Duration(amount) * time.Second)
+}
+
+// roundDate rounds the date down to the start of the unit, or to its last millisecond when rounding up.
+// Weeks start on Monday.
+func roundDate(date time.Time, unit string, roundUp bool) time.Time {
+	year, month, day := date.Date()
+	location := date.Location()
+	var start time.Time
+	switch unit {
+	case "y":
+		start = time.Date(year, time.January, 1, 0, 0, 0, 0, location)
+	case "M":
+		start = time.Date(year, month, 1, 0, 0, 0, 0, location)
+	case "w":
+		start = time.Date(year, month, day-(int(date.Weekday())+6)%7, 0, 0, 0, 0, location)
+	case "d":
+		start = time.Date(year, month, day, 0, 0, 0, 0, location)
+	case "h", "H":
+		start = time.Date(year, month, day, date.Hour(), 0, 0, 0, location)
+	case "m":
+		start = time.Date(year, month, day, date.Hour(), date.Minute(), 0, 0, location)
+	default:
+		start = time.Date(year, month, day, date.Hour(), date.Minute(), date.Second(), 0, location)
+	}
+	if !roundUp {
+		return start
+	}
+	return addToDate(start, 1, unit).Add(-time.Millisecond)
+}
+
+func toMillis(date time.Time) int64 {
+	return date.UnixNano() / int64(time.Millisecond)
+}
@@ -0,0 +1,55 @@
+package options
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	now := time.Date(2021, time.March, 10, 14, 35, 20, 0, time.UTC).In(time.Local)
+	local := func(year int, month time.Month, day, hour, minute, second, millis int) int64 {
+		return toMillis(time.Date(year, month, day, hour, minute, second, millis*int(time.Millisecond), time.Local))
+	}
+	year, month, day := now.Date()
+	tests := []struct {
+		expression string
+		roundUp    bool
+		expected   int64
+	}{
+		{"", true, toMillis(now)},
+		{"now", true, toMillis(now)},
+		{"15m", false, toMillis(now.Add(-15 * time.Minute))},
+		{"1h30m", false, toMillis(now.Add(-90 * time.Minute))},
+		{"7d", false, toMillis(now.Add(-7 * 24 * time.Hour))},
+		{"2w", false, toMillis(now.Add(-14 * 24 * time.Hour))},
+		{"1d12h", false, toMillis(now.Add(-36 * time.Hour))},
+		{"2021-03-09T02:00:00Z", false, toMillis(time.Date(2021, time.March, 9, 2, 0, 0, 0, time.UTC))},
+		{"2021-03-09T03:00:00+01:00", false, toMillis(time.Date(2021, time.March, 9, 2, 0, 0, 0, time.UTC))},
+		{"2021-03-09", false, local(2021, time.March, 9, 0, 0, 0, 0)},
+		{"1615255200000", false, 1615255200000},
+		{"now-1d/d", false, local(year, month, day-1, 0, 0, 0, 0)},
+		{"now-1d/d", true, local(year, month, day-1, 23, 59, 59, 999)},
+		{"now/h+1m", false, local(year, month, day, now.Hour(), 1, 0, 0)},
+		{"2021-03-09||+1M/M", false, local(2021, time.April, 1, 0, 0, 0, 0)},
+		{"2021-03-10||/w", false, local(2021, time.March, 8, 0, 0, 0, 0)},
+	}
+	for _, test := range tests {
+		actual, err := parseTimestamp(test.expression, now, test.roundUp)
+		if err != nil {
+			t.Errorf("Parsing '%s' must succeed: %s", test.expression, err)
+			continue
+		}
+		if actual != test.expected {
+			t.Errorf("Expected '%s' to be %d but was %d", test.expression, test.expected, actual)
+		}
+	}
+}
+
+func TestParseInvalidTimestamp(t *testing.T) {
+	for _, expression := range []string{"yesterday", "15x", "now-1q", "now+", "2021-13-01"} {
+		_, err := parseTimestamp(expression, time.Now(), false)
+		if err == nil {
+			t.Errorf("Parsing '%s' must fail", expression)
+		}
+	}
+}
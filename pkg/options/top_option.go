@@ -0,0 +1,124 @@
+package options
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sidilabs/kishell/pkg/output"
+)
+
+const (
+	topAggregation   = "top"
+	otherValuesLabel = "(other)"
+)
+
+// TermCount represents how many documents hold a value.
+type TermCount struct {
+	Value string
+	Count int64
+}
+
+// topBody gives the search request finding the most common values of the field.
+func topBody(searchParams SearchParams) searchRequest {
+	return searchRequest{
+		Aggs: map[string]aggregation{topAggregation: {
+			Terms: &termsAggregation{Field: searchParams.Field, Size: searchParams.Size},
+		}},
+		Query: searchParams.query(),
+	}
+}
+
+// Run the top option.
+// Finds the most common values of a field among documents matching the query within the time window.
+// Prints each value followed by its count.
+func (t *TopCmd) Run(ctx *Context) error {
+	err := ctx.Configuration.CheckEmpty()
+	if err != nil {
+		return err
+	}
+	if t.Size <= 0 {
+		return fmt.Errorf("size must be greater than zero but was %d", t.Size)
+	}
+	server, searchParams, err := t.target(ctx.Configuration)
+	if err != nil {
+		return err
+	}
+	searchParams.Field = t.Field
+	searchParams.Size = t.Size
+	body, err := buildBody(topBody(searchParams))
+	if err != nil {
+		return err
+	}
+	data, err := t.callApi(server, searchParams.Index, body)
+	if err != nil {
+		return err
+	}
+	err = data.failure()
+	if err != nil {
+		return err
+	}
+	terms, other, err := data.terms(topAggregation)
+	if err != nil {
+		return err
+	}
+	if t.Other {
+		terms = append(terms, TermCount{Value: otherValuesLabel, Count: other})
+	}
+	printTerms(terms)
+	return nil
+}
+
+// printTerms prints each value followed by its count, aligned as columns.
+func printTerms(terms []TermCount) {
+	valueWidth, countWidth := 0, 0
+	for _, term := range terms {
+		if width := utf8.RuneCountInString(term.Value); width > valueWidth {
+			valueWidth = width
+		}
+		if width := len(strconv.FormatInt(term.Count, 10)); width > countWidth {
+			countWidth = width
+		}
+	}
+	for _, term := range terms {
+		padding := strings.Repeat(" ", valueWidth-utf8.RuneCountInString(term.Value))
+		fmt.Printf("%s%s  %*d\n", term.Value, padding, countWidth, term.Count)
+	}
+}
+
+// terms gives the buckets of the terms aggregation found in the first response, along with how many documents
+// hold values left out of them.
+func (r *ResponseData) terms(aggregation string) ([]TermCount, int64, error) {
+	for _, response := range r.responses() {
+		aggregations, _ := response["aggregations"].(map[string]interface{})
+		result, ok := aggregations[aggregation].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		other, err := toInt64(result["sum_other_doc_count"])
+		if err != nil {
+			return nil, 0, err
+		}
+		items, _ := result["buckets"].([]interface{})
+		terms := make([]TermCount, 0, len(items))
+		for _, item := range items {
+			bucket, _ := item.(map[string]interface{})
+			count, err := toInt64(bucket["doc_count"])
+			if err != nil {
+				return nil, 0, err
+			}
+			value := bucket["key_as_string"]
+			if value == nil {
+				value = bucket["key"]
+			}
+			terms = append(terms, TermCount{
+				Value: output.Format(value),
+				Count: count,
+			})
+		}
+		return terms, other, nil
+	}
+	return nil, 0, errors.New("unable to find the top values in the response")
+}
@@ -0,0 +1,74 @@
+package options
+
+import (
+	"bytes"
+	"github.com/sidilabs/kishell/pkg/config"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestTopValues(t *testing.T) {
+	configuration := new(ConfigurationMock)
+	configuration.On("CheckEmpty").Return(nil)
+	configuration.On("GetCurrentServer").Return(config.Server{Protocol: "http", Hostname: "ut.server"})
+	configuration.On("GetCurrentRole").Return(config.Role{Index: "ut-*", WindowFilter: "@timestamp"})
+
+	httpClient := new(MockHttpClient)
+	httpClient.Request = http.Request{
+		Header: map[string][]string{},
+	}
+	termsPayload := mock.MatchedBy(func(body *bytes.Buffer) bool {
+		return strings.Contains(body.String(), `"aggs":{"top":{"terms":{"field":"clientip","size":2}}}`)
+	})
+	httpClient.On("NewRequest", "POST", mock.Anything, termsPayload).Return(&httpClient.Request, nil)
+	httpClient.On("Call", &httpClient.Request).Return(jsonResponse(`{ "responses": [ { "aggregations": { "top": {
+		"sum_other_doc_count": 7, "buckets": [ { "key": "10.0.0.1", "doc_count": 30 }, { "key": "10.0.0.2", "doc_count": 12 } ] } } } ] }`), nil)
+
+	context := Context{
+		Debug:         true,
+		Configuration: configuration,
+	}
+	cmd := TopCmd{
+		FilterFlags: FilterFlags{httpClient: httpClient},
+		Field:       "clientip",
+		Size:        2,
+		Other:       true,
+	}
+
+	err := cmd.Run(&context)
+	if err != nil {
+		t.Fatal("Finding the top values must succeed", err)
+	}
+	httpClient.AssertExpectations(t)
+}
+
+func TestTermsWithNumericKeys(t *testing.T) {
+	data, err := parseResponse(jsonResponse(`{ "responses": [ { "aggregations": { "top": {
+		"sum_other_doc_count": 0, "buckets": [ { "key": 404, "doc_count": 5 } ] } } } ] }`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	terms, other, err := data.terms(topAggregation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(terms) != 1 || terms[0].Value != "404" || terms[0].Count != 5 || other != 0 {
+		t.Fatalf("Unexpected terms %v and other count %d", terms, other)
+	}
+}
+
+func TestTopInvalidSize(t *testing.T) {
+	configuration := new(ConfigurationMock)
+	configuration.On("CheckEmpty").Return(nil)
+	context := Context{
+		Debug:         true,
+		Configuration: configuration,
+	}
+	cmd := TopCmd{Field: "clientip"}
+	err := cmd.Run(&context)
+	if err == nil {
+		t.Fatal("Finding the top values must fail without a size")
+	}
+}
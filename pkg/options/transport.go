@@ -0,0 +1,216 @@
+package options
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/go-http-utils/headers"
+	"github.com/sidilabs/kishell/pkg/config"
+	"github.com/sidilabs/kishell/pkg/utils"
+)
+
+const (
+	kibanaVersionHeaderKey = "kbn-version"
+	postContentType        = "application/x-ndjson"
+	jsonContentType        = "application/json"
+	esSearchPath           = "/elasticsearch/_msearch"
+	msearchPath            = "/_msearch"
+	internalSearchPath     = "/internal/search/es"
+	consoleProxyPath       = "/api/console/proxy"
+	internalOriginKey      = "x-elastic-internal-origin"
+	apiVersionKey          = "elastic-api-version"
+)
+
+// InternalSearchParams represents attributes used to search through the Kibana internal search API.
+type InternalSearchParams struct {
+	Index             string          `json:"index"`
+	IgnoreUnavailable bool            `json:"ignore_unavailable"`
+	Body              json.RawMessage `json:"body"`
+}
+
+// internalSearchRequest represents the body of a Kibana internal search request.
+type internalSearchRequest struct {
+	Params InternalSearchParams `json:"params"`
+}
+
+// A transport represents a contract to send requests to the Elasticsearch API of a server.
+type transport interface {
+	// search runs the search request body against the index.
+	search(index string, body bytes.Buffer) (*ResponseData, error)
+	// msearch runs several searches in one request. The body holds a header line and a body line per search.
+	msearch(body bytes.Buffer) (*ResponseData, error)
+	// call sends the request body to any Elasticsearch API path, e.g. /_search/scroll.
+	call(method string, path string, body bytes.Buffer) (*ResponseData, error)
+}
+
+// kibanaTransport reaches Elasticsearch through Kibana. Searches go through the legacy _msearch proxy up to
+// Kibana 7.9, which was removed afterwards in favor of the internal search API. Any other call goes through the
+// console proxy.
+type kibanaTransport struct {
+	server     config.Server
+	httpClient utils.HTTPClient
+}
+
+// elasticsearchTransport reaches Elasticsearch straight.
+type elasticsearchTransport struct {
+	server     config.Server
+	httpClient utils.HTTPClient
+}
+
+func newTransport(server config.Server, httpClient utils.HTTPClient) transport {
+	if server.GetType() == config.ElasticsearchServer {
+		return &elasticsearchTransport{server: server, httpClient: httpClient}
+	}
+	return &kibanaTransport{server: server, httpClient: httpClient}
+}
+
+func (f *FilterFlags) callApi(server config.Server, index string, body bytes.Buffer) (*ResponseData, error) {
+	httpClient, err := serverHTTPClient(server, f.httpClient)
+	if err != nil {
+		return nil, err
+	}
+	return newTransport(server, httpClient).search(index, body)
+}
+
+func (f *FilterFlags) call(server config.Server, method string, path string, body bytes.Buffer) (*ResponseData, error) {
+	httpClient, err := serverHTTPClient(server, f.httpClient)
+	if err != nil {
+		return nil, err
+	}
+	return newTransport(server, httpClient).call(method, path, body)
+}
+
+// serverHTTPClient gives the http client set up with the TLS settings of the server.
+func serverHTTPClient(server config.Server, httpClient utils.HTTPClient) (utils.HTTPClient, error) {
+	httpClient, err := httpClient.WithTLS(tlsSettings(server))
+	if err != nil {
+		return nil, fmt.Errorf("unable to set up TLS for server: %s", err)
+	}
+	return httpClient, nil
+}
+
+// tlsSettings gives the TLS settings of the server.
+func tlsSettings(server config.Server) utils.TLSSettings {
+	return utils.TLSSettings{
+		CAFile:             server.CAFile,
+		ClientCert:         server.ClientCert,
+		ClientKey:          server.ClientKey,
+		InsecureSkipVerify: server.InsecureSkipVerify,
+	}
+}
+
+func (t *kibanaTransport) search(index string, body bytes.Buffer) (*ResponseData, error) {
+	if t.server.VersionAtLeast(7, 10) {
+		return t.internalSearch(index, body)
+	}
+	payload, err := buildBody(newMsearchHeader(index))
+	if err != nil {
+		return nil, err
+	}
+	payload.WriteString(lineBreak)
+	payload.Write(body.Bytes())
+	payload.WriteString(lineBreak)
+	return t.post(esSearchPath, postContentType, payload)
+}
+
+// internalSearch searches through the internal search API, unwrapping the Elasticsearch response out of the
+// envelope Kibana returns, e.g. {"id":"...","rawResponse":{...},"isPartial":false,"isRunning":false}.
+func (t *kibanaTransport) internalSearch(index string, body bytes.Buffer) (*ResponseData, error) {
+	payload, err := buildBody(internalSearchRequest{Params: InternalSearchParams{
+		Index:             index,
+		IgnoreUnavailable: true,
+		Body:              json.RawMessage(body.Bytes()),
+	}})
+	if err != nil {
+		return nil, err
+	}
+	data, err := t.post(internalSearchPath, jsonContentType, payload)
+	if err != nil {
+		return nil, err
+	}
+	rawResponse, ok := data.Payload["rawResponse"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("unable to find the Elasticsearch response in the Kibana internal search response")
+	}
+	return &ResponseData{Payload: rawResponse}, nil
+}
+
+// msearch goes through the legacy _msearch proxy up to Kibana 7.9, and through the console proxy afterwards.
+func (t *kibanaTransport) msearch(body bytes.Buffer) (*ResponseData, error) {
+	if t.server.VersionAtLeast(7, 10) {
+		return t.call("POST", msearchPath, body)
+	}
+	return t.post(esSearchPath, postContentType, body)
+}
+
+// call sends the request through the Kibana console proxy, which forwards any Elasticsearch API call.
+func (t *kibanaTransport) call(method string, path string, body bytes.Buffer) (*ResponseData, error) {
+	query := url.Values{}
+	query.Set("method", method)
+	query.Set("path", path)
+	return t.post(consoleProxyPath+"?"+query.Encode(), jsonContentType, body)
+}
+
+func (t *kibanaTransport) post(path string, contentType string, payload bytes.Buffer) (*ResponseData, error) {
+	extraHeaders := map[string]string{
+		kibanaVersionHeaderKey: t.server.KibanaVersion,
+	}
+	if t.server.VersionAtLeast(8, 0) {
+		extraHeaders[internalOriginKey] = "Kibana"
+		extraHeaders[apiVersionKey] = "1"
+	}
+	return send(t.httpClient, t.server, "POST", path, contentType, payload, extraHeaders)
+}
+
+func (t *elasticsearchTransport) search(index string, body bytes.Buffer) (*ResponseData, error) {
+	path := fmt.Sprintf("/%s/_search?ignore_unavailable=true", index)
+	return t.call("POST", path, body)
+}
+
+func (t *elasticsearchTransport) msearch(body bytes.Buffer) (*ResponseData, error) {
+	return send(t.httpClient, t.server, "POST", msearchPath, postContentType, body, nil)
+}
+
+func (t *elasticsearchTransport) call(method string, path string, body bytes.Buffer) (*ResponseData, error) {
+	return send(t.httpClient, t.server, method, path, jsonContentType, body, nil)
+}
+
+// intervalKey gives the date_histogram parameter holding the interval. Elasticsearch 7.2 deprecated "interval"
+// in favor of "calendar_interval" for calendar units and "fixed_interval" for the others, and 8.0 removed it.
+func intervalKey(server config.Server, interval string) string {
+	if !server.VersionAtLeast(7, 2) {
+		return "interval"
+	}
+	if strings.IndexAny(interval, "wMqy") >= 0 {
+		return "calendar_interval"
+	}
+	return "fixed_interval"
+}
+
+func send(httpClient utils.HTTPClient, server config.Server, method string, path string, contentType string,
+	payload bytes.Buffer, extraHeaders map[string]string) (*ResponseData, error) {
+	endpoint := fmt.Sprintf("%s://%s:%s%s", server.Protocol, server.Hostname, server.GetPort(), path)
+
+	request, err := httpClient.NewRequest(method, endpoint, &payload)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Add(headers.ContentType, contentType)
+	for key, value := range extraHeaders {
+		request.Header.Add(key, value)
+	}
+	if authorization := server.Authorization(); len(authorization) > 0 {
+		request.Header.Add(headers.Authorization, authorization)
+	}
+
+	response, err := httpClient.Call(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	return parseResponse(response)
+}
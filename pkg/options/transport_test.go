@@ -0,0 +1,194 @@
+package options
+
+import (
+	"bytes"
+	"github.com/go-http-utils/headers"
+	"github.com/sidilabs/kishell/pkg/config"
+	"github.com/sidilabs/kishell/pkg/utils"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestKibanaTransportSearch(t *testing.T) {
+	httpClient := new(MockHttpClient)
+	httpClient.Request = http.Request{
+		Header: map[string][]string{},
+	}
+	msearchPayload := mock.MatchedBy(func(body *bytes.Buffer) bool {
+		return body.String() == `{"index":"ut-*","ignore_unavailable":true,"preference":1569331617740}`+"\n{}\n"
+	})
+	httpClient.On("NewRequest", "POST", "https://kibana.ut:443/elasticsearch/_msearch", msearchPayload).Return(&httpClient.Request, nil)
+	httpClient.On("Call", &httpClient.Request).Return(jsonResponse(`{ "responses": [] }`), nil)
+
+	server := config.Server{Protocol: "https", Hostname: "kibana.ut", KibanaVersion: "6.8.6"}
+	_, err := newTransport(server, httpClient).search("ut-*", *bytes.NewBufferString("{}"))
+	if err != nil {
+		t.Fatal("Searching through Kibana must succeed", err)
+	}
+	if httpClient.Request.Header.Get(kibanaVersionHeaderKey) != "6.8.6" {
+		t.Fatal("Requests through Kibana must hold the Kibana version header")
+	}
+	if httpClient.Request.Header.Get(headers.ContentType) != postContentType {
+		t.Fatal("Requests through Kibana must be sent as ndjson")
+	}
+	httpClient.AssertExpectations(t)
+}
+
+func TestElasticsearchTransportSearch(t *testing.T) {
+	httpClient := new(MockHttpClient)
+	httpClient.Request = http.Request{
+		Header: map[string][]string{},
+	}
+	searchPayload := mock.MatchedBy(func(body *bytes.Buffer) bool {
+		return body.String() == "{}"
+	})
+	endpoint := "http://es.ut:9200/ut-*/_search?ignore_unavailable=true"
+	httpClient.On("NewRequest", "POST", endpoint, searchPayload).Return(&httpClient.Request, nil)
+	httpClient.On("Call", &httpClient.Request).Return(jsonResponse(`{ "hits": { "hits": [ { "_source": {} } ] } }`), nil)
+
+	server := config.Server{Type: config.ElasticsearchServer, Protocol: "http", Hostname: "es.ut"}
+	data, err := newTransport(server, httpClient).search("ut-*", *bytes.NewBufferString("{}"))
+	if err != nil {
+		t.Fatal("Searching Elasticsearch straight must succeed", err)
+	}
+	if len(data.hits()) != 1 {
+		t.Fatal("Hits must be read from a plain search response")
+	}
+	if len(httpClient.Request.Header.Get(kibanaVersionHeaderKey)) > 0 {
+		t.Fatal("Requests straight to Elasticsearch must not hold the Kibana version header")
+	}
+	httpClient.AssertExpectations(t)
+}
+
+func TestElasticsearchTransportCall(t *testing.T) {
+	httpClient := new(MockHttpClient)
+	httpClient.Request = http.Request{
+		Header: map[string][]string{},
+	}
+	httpClient.On("NewRequest", "DELETE", "http://es.ut:9200/_search/scroll", mock.Anything).Return(&httpClient.Request, nil)
+	httpClient.On("Call", &httpClient.Request).Return(jsonResponse(`{ "succeeded": true }`), nil)
+
+	server := config.Server{Type: config.ElasticsearchServer, Protocol: "http", Hostname: "es.ut"}
+	_, err := newTransport(server, httpClient).call("DELETE", scrollPath, bytes.Buffer{})
+	if err != nil {
+		t.Fatal("Calling Elasticsearch straight must succeed", err)
+	}
+	httpClient.AssertExpectations(t)
+}
+
+func TestApiKeyAuthorization(t *testing.T) {
+	httpClient := new(MockHttpClient)
+	httpClient.Request = http.Request{
+		Header: map[string][]string{},
+	}
+	httpClient.On("NewRequest", "DELETE", "http://es.ut:9200/_search/scroll", mock.Anything).Return(&httpClient.Request, nil)
+	httpClient.On("Call", &httpClient.Request).Return(jsonResponse(`{ "succeeded": true }`), nil)
+
+	server := config.Server{Type: config.ElasticsearchServer, Protocol: "http", Hostname: "es.ut",
+		AuthType: config.APIKeyAuth, Token: "aWQ6a2V5"}
+	_, err := newTransport(server, httpClient).call("DELETE", scrollPath, bytes.Buffer{})
+	if err != nil {
+		t.Fatal("Calling Elasticsearch with an API key must succeed", err)
+	}
+	if authorization := httpClient.Request.Header.Get("Authorization"); authorization != "ApiKey aWQ6a2V5" {
+		t.Errorf("Unexpected Authorization header %s", authorization)
+	}
+	httpClient.AssertExpectations(t)
+}
+
+func TestServerTLSSettings(t *testing.T) {
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headers.ContentType, "application/json")
+		w.Write([]byte(`{ "succeeded": true }`))
+	}))
+	defer tlsServer.Close()
+	endpoint, _ := url.Parse(tlsServer.URL)
+
+	filterFlags := FilterFlags{httpClient: &utils.DefaultHTTPClient{Timeout: 5 * time.Second}}
+	server := config.Server{Type: config.ElasticsearchServer, Protocol: "https", Hostname: endpoint.Hostname(),
+		Port: endpoint.Port()}
+	if _, err := filterFlags.call(server, "DELETE", scrollPath, bytes.Buffer{}); err == nil {
+		t.Fatal("Self-signed certificate must be rejected by default")
+	}
+	server.InsecureSkipVerify = true
+	if _, err := filterFlags.call(server, "DELETE", scrollPath, bytes.Buffer{}); err != nil {
+		t.Fatal("Server TLS settings must be applied", err)
+	}
+	server.InsecureSkipVerify = false
+	server.ClientCert = "client.pem"
+	if _, err := filterFlags.call(server, "DELETE", scrollPath, bytes.Buffer{}); err == nil {
+		t.Fatal("Invalid TLS settings must be reported")
+	}
+}
+
+func TestKibanaInternalSearch(t *testing.T) {
+	httpClient := new(MockHttpClient)
+	httpClient.Request = http.Request{
+		Header: map[string][]string{},
+	}
+	internalPayload := mock.MatchedBy(func(body *bytes.Buffer) bool {
+		return body.String() == `{"params":{"index":"ut-*","ignore_unavailable":true,"body":{"size":1}}}`
+	})
+	httpClient.On("NewRequest", "POST", "https://kibana.ut:443/internal/search/es", internalPayload).Return(&httpClient.Request, nil)
+	httpClient.On("Call", &httpClient.Request).Return(jsonResponse(`{ "id": "ut", "isPartial": false, "isRunning": false,
+		"rawResponse": { "hits": { "total": { "value": 1, "relation": "eq" }, "hits": [ { "_source": {} } ] } } }`), nil)
+
+	server := config.Server{Protocol: "https", Hostname: "kibana.ut", KibanaVersion: "8.2.0"}
+	data, err := newTransport(server, httpClient).search("ut-*", *bytes.NewBufferString(`{"size":1}`))
+	if err != nil {
+		t.Fatal("Searching through the Kibana internal search API must succeed", err)
+	}
+	if len(data.hits()) != 1 {
+		t.Fatal("Hits must be unwrapped from the Kibana internal search response")
+	}
+	if httpClient.Request.Header.Get(internalOriginKey) != "Kibana" {
+		t.Fatal("Requests to Kibana 8 internal APIs must hold the internal origin header")
+	}
+	httpClient.AssertExpectations(t)
+}
+
+func TestIntervalKey(t *testing.T) {
+	tests := []struct {
+		server   config.Server
+		interval string
+		expected string
+	}{
+		{config.Server{KibanaVersion: "6.8.6"}, "3h", "interval"},
+		{config.Server{}, "3h", "interval"},
+		{config.Server{KibanaVersion: "7.2.0"}, "3h", "fixed_interval"},
+		{config.Server{KibanaVersion: "8.2.0"}, "1w", "calendar_interval"},
+		{config.Server{KibanaVersion: "7.10.2"}, "1M", "calendar_interval"},
+		{config.Server{Type: config.ElasticsearchServer, ElasticsearchVersion: "8.11.0"}, "3h", "fixed_interval"},
+		{config.Server{Type: config.ElasticsearchServer, KibanaVersion: "8.11.0"}, "3h", "interval"},
+	}
+	for _, test := range tests {
+		actual := intervalKey(test.server, test.interval)
+		if actual != test.expected {
+			t.Errorf("Expected interval key for %s on %+v to be %s but was %s", test.interval, test.server, test.expected, actual)
+		}
+	}
+}
+
+func TestKibanaTransportMsearch(t *testing.T) {
+	for version, endpoint := range map[string]string{
+		"7.9.3":  "https://kibana.ut:443/elasticsearch/_msearch",
+		"7.10.2": "https://kibana.ut:443/api/console/proxy?method=POST&path=%2F_msearch",
+	} {
+		httpClient := new(MockHttpClient)
+		httpClient.Request = http.Request{
+			Header: map[string][]string{},
+		}
+		httpClient.On("NewRequest", "POST", endpoint, mock.Anything).Return(&httpClient.Request, nil)
+		httpClient.On("Call", &httpClient.Request).Return(jsonResponse(`{ "responses": [] }`), nil)
+
+		server := config.Server{Protocol: "https", Hostname: "kibana.ut", KibanaVersion: version}
+		if _, err := newTransport(server, httpClient).msearch(*bytes.NewBufferString("{}\n{}\n")); err != nil {
+			t.Fatal("Multi-searching through Kibana must succeed", err)
+		}
+		httpClient.AssertExpectations(t)
+	}
+}
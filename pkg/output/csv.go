@@ -0,0 +1,51 @@
+package output
+
+import (
+	"encoding/csv"
+	"io"
+)
+
+// CSVPrinter prints hits as delimiter separated values, starting with a header row.
+// When no fields are selected the columns are taken from the first hit printed.
+type CSVPrinter struct {
+	writer  *csv.Writer
+	fields  []string
+	started bool
+}
+
+// NewCSVPrinter creates a printer separating values with the given delimiter.
+func NewCSVPrinter(delimiter rune, fields []string, writer io.Writer) *CSVPrinter {
+	csvWriter := csv.NewWriter(writer)
+	csvWriter.Comma = delimiter
+	return &CSVPrinter{
+		writer: csvWriter,
+		fields: fields,
+	}
+}
+
+// Print prints the hit as a row.
+func (p *CSVPrinter) Print(hit map[string]interface{}) error {
+	if !p.started {
+		if len(p.fields) <= 0 {
+			p.fields = Columns(hit)
+		}
+		err := p.writer.Write(p.fields)
+		if err != nil {
+			return err
+		}
+		p.started = true
+	}
+	source, _ := hit[sourceKey].(map[string]interface{})
+	flat := Flatten(source)
+	row := make([]string, len(p.fields))
+	for i, field := range p.fields {
+		row[i] = Format(Lookup(hit, flat, field))
+	}
+	return p.writer.Write(row)
+}
+
+// Flush writes any buffered row.
+func (p *CSVPrinter) Flush() error {
+	p.writer.Flush()
+	return p.writer.Error()
+}
@@ -0,0 +1,72 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func hitFrom(t *testing.T, source string) map[string]interface{} {
+	var hit map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(source))
+	decoder.UseNumber()
+	err := decoder.Decode(&hit)
+	if err != nil {
+		t.Fatal("Invalid hit", err)
+	}
+	return hit
+}
+
+func TestCSVWithSelectedFields(t *testing.T) {
+	var out bytes.Buffer
+	printer, err := New(CSVFormat, []string{"@timestamp", "clientip", "geo.city", "tags", "_id"}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hits := []string{
+		`{"_id":"1","_source":{"@timestamp":"2021-01-01T00:00:00Z","clientip":"10.0.0.1","geo":{"city":"Porto, PT"},"tags":["a","b"]}}`,
+		`{"_id":"2","_source":{"@timestamp":"2021-01-01T00:00:01Z","clientip":"10.0.0.2","message":"said \"hi\""}}`,
+	}
+	for _, hit := range hits {
+		if err = printer.Print(hitFrom(t, hit)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = printer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	expected := "@timestamp,clientip,geo.city,tags,_id\n" +
+		"2021-01-01T00:00:00Z,10.0.0.1,\"Porto, PT\",a|b,1\n" +
+		"2021-01-01T00:00:01Z,10.0.0.2,,,2\n"
+	if out.String() != expected {
+		t.Fatalf("Expected CSV to be %q but was %q", expected, out.String())
+	}
+}
+
+func TestTSVWithColumnsFromFirstHit(t *testing.T) {
+	var out bytes.Buffer
+	printer, err := New(TSVFormat, nil, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = printer.Print(hitFrom(t, `{"_source":{"response":200,"message":"said \"hi\"","geo":{"lat":1.5,"lon":-3}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = printer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	expected := "geo.lat\tgeo.lon\tmessage\tresponse\n" +
+		"1.5\t-3\t\"said \"\"hi\"\"\"\t200\n"
+	if out.String() != expected {
+		t.Fatalf("Expected TSV to be %q but was %q", expected, out.String())
+	}
+}
+
+func TestInvalidFormat(t *testing.T) {
+	_, err := New("xml", nil, &bytes.Buffer{})
+	if err == nil {
+		t.Fatal("Creating a printer for an unknown format must fail")
+	}
+}
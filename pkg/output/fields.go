@@ -0,0 +1,78 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// ArraySeparator joins the values of an array into a single column.
+	ArraySeparator = "|"
+	sourceKey      = "_source"
+)
+
+// Flatten flattens nested objects into a single level map whose keys are the dotted path to each value.
+// E.g. {"geo":{"lat":1}} becomes {"geo.lat":1}.
+func Flatten(source map[string]interface{}) map[string]interface{} {
+	flat := map[string]interface{}{}
+	flatten("", source, flat)
+	return flat
+}
+
+func flatten(prefix string, source map[string]interface{}, flat map[string]interface{}) {
+	for key, value := range source {
+		if len(prefix) > 0 {
+			key = prefix + "." + key
+		}
+		if nested, ok := value.(map[string]interface{}); ok {
+			flatten(key, nested, flat)
+			continue
+		}
+		flat[key] = value
+	}
+}
+
+// Columns lists the dotted names of every value found in the hit source, sorted by name.
+func Columns(hit map[string]interface{}) []string {
+	source, _ := hit[sourceKey].(map[string]interface{})
+	var columns []string
+	for key := range Flatten(source) {
+		columns = append(columns, key)
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// Lookup finds a field value in a flattened source. Hit metadata like _id or _index is used when the source
+// has no such field.
+func Lookup(hit map[string]interface{}, flat map[string]interface{}, field string) interface{} {
+	if value, ok := flat[field]; ok {
+		return value
+	}
+	return hit[field]
+}
+
+// Format renders a field value as text. Arrays are joined with ArraySeparator and objects are rendered as JSON.
+func Format(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []interface{}:
+		values := make([]string, len(v))
+		for i, item := range v {
+			values[i] = Format(item)
+		}
+		return strings.Join(values, ArraySeparator)
+	case map[string]interface{}:
+		asJSON, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(asJSON)
+	}
+	return fmt.Sprint(value)
+}
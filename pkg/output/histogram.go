@@ -0,0 +1,97 @@
+package output
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	bucketLayout = "2006-01-02 15:04:05"
+	barRune      = "█"
+)
+
+var sparkRunes = []rune("▁▂▃▄▅▆▇█")
+
+// A Bucket represents the number of documents found within a time interval starting at Key.
+type Bucket struct {
+	Key   time.Time
+	Count int64
+}
+
+// PrintBars prints a horizontal bar per bucket, scaled to fit within width characters.
+func PrintBars(writer io.Writer, buckets []Bucket, width int) error {
+	max := maxCount(buckets)
+	countWidth := len(strconv.FormatInt(max, 10))
+	barWidth := width - utf8.RuneCountInString(bucketLayout) - countWidth - 2*utf8.RuneCountInString(columnGap)
+	if barWidth < 1 {
+		barWidth = 1
+	}
+	for _, bucket := range buckets {
+		length := 0
+		if max > 0 {
+			length = int(bucket.Count * int64(barWidth) / max)
+		}
+		if length <= 0 && bucket.Count > 0 {
+			length = 1
+		}
+		line := fmt.Sprintf("%s%s%*d%s%s", bucket.Key.Local().Format(bucketLayout), columnGap, countWidth,
+			bucket.Count, columnGap, strings.Repeat(barRune, length))
+		_, err := fmt.Fprintln(writer, strings.TrimRight(line, " "))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PrintSparkline prints every bucket as a single line of block characters, followed by the time range and the
+// highest count.
+func PrintSparkline(writer io.Writer, buckets []Bucket) error {
+	if len(buckets) <= 0 {
+		return nil
+	}
+	max := maxCount(buckets)
+	line := make([]rune, len(buckets))
+	for i, bucket := range buckets {
+		level := 0
+		if max > 0 {
+			level = int(bucket.Count * int64(len(sparkRunes)-1) / max)
+		}
+		line[i] = sparkRunes[level]
+	}
+	_, err := fmt.Fprintf(writer, "%s\n%s - %s, max %d\n", string(line), buckets[0].Key.Local().Format(bucketLayout),
+		buckets[len(buckets)-1].Key.Local().Format(bucketLayout), max)
+	return err
+}
+
+// PrintBucketsCSV prints the buckets as comma separated values, starting with a header row.
+func PrintBucketsCSV(writer io.Writer, buckets []Bucket) error {
+	csvWriter := csv.NewWriter(writer)
+	err := csvWriter.Write([]string{"timestamp", "count"})
+	if err != nil {
+		return err
+	}
+	for _, bucket := range buckets {
+		err = csvWriter.Write([]string{bucket.Key.Format(time.RFC3339), strconv.FormatInt(bucket.Count, 10)})
+		if err != nil {
+			return err
+		}
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+func maxCount(buckets []Bucket) int64 {
+	var max int64
+	for _, bucket := range buckets {
+		if bucket.Count > max {
+			max = bucket.Count
+		}
+	}
+	return max
+}
@@ -0,0 +1,42 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func testBuckets() []Bucket {
+	start := time.Date(2021, time.January, 1, 0, 0, 0, 0, time.Local)
+	return []Bucket{
+		{Key: start, Count: 8},
+		{Key: start.Add(time.Hour), Count: 0},
+		{Key: start.Add(2 * time.Hour), Count: 4},
+	}
+}
+
+func TestPrintBars(t *testing.T) {
+	var out bytes.Buffer
+	err := PrintBars(&out, testBuckets(), 28)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "2021-01-01 00:00:00  8  ████\n" +
+		"2021-01-01 01:00:00  0\n" +
+		"2021-01-01 02:00:00  4  ██\n"
+	if out.String() != expected {
+		t.Fatalf("Expected bars to be %q but was %q", expected, out.String())
+	}
+}
+
+func TestPrintSparkline(t *testing.T) {
+	var out bytes.Buffer
+	err := PrintSparkline(&out, testBuckets())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "█▁▄\n2021-01-01 00:00:00 - 2021-01-01 02:00:00, max 8\n"
+	if out.String() != expected {
+		t.Fatalf("Expected sparkline to be %q but was %q", expected, out.String())
+	}
+}
@@ -0,0 +1,62 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+const (
+	// JSONFormat prints the source of each hit as a JSON document per line.
+	JSONFormat = "json"
+	// CSVFormat prints the selected fields of each hit as comma separated values.
+	CSVFormat = "csv"
+	// TSVFormat prints the selected fields of each hit as tab separated values.
+	TSVFormat = "tsv"
+	// TableFormat prints the selected fields of each hit as aligned columns.
+	TableFormat = "table"
+
+	defaultTerminalWidth = 80
+)
+
+// A Printer represents a contract to print search hits.
+type Printer interface {
+	Print(hit map[string]interface{}) error
+	Flush() error
+}
+
+// JSONPrinter prints the source of each hit as a JSON document per line.
+type JSONPrinter struct {
+	writer io.Writer
+}
+
+// New creates the printer for the given format. Fields select which source fields are printed by formats
+// laying out hits as columns.
+func New(format string, fields []string, writer io.Writer) (Printer, error) {
+	switch format {
+	case "", JSONFormat:
+		return &JSONPrinter{writer: writer}, nil
+	case CSVFormat:
+		return NewCSVPrinter(',', fields, writer), nil
+	case TSVFormat:
+		return NewCSVPrinter('\t', fields, writer), nil
+	case TableFormat:
+		return NewTablePrinter(fields, TerminalWidth(writer), writer), nil
+	}
+	return nil, fmt.Errorf("output format '%s' is invalid", format)
+}
+
+// Print prints the hit source as JSON.
+func (p *JSONPrinter) Print(hit map[string]interface{}) error {
+	asJSON, err := json.Marshal(hit["_source"])
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(p.writer, string(asJSON))
+	return err
+}
+
+// Flush does nothing as every hit is printed right away.
+func (p *JSONPrinter) Flush() error {
+	return nil
+}
@@ -0,0 +1,121 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	columnGap      = "  "
+	ellipsis       = "…"
+	minColumnWidth = 3
+)
+
+// DefaultTableFields are the columns printed by the table format when no fields are selected.
+var DefaultTableFields = []string{"@timestamp", "message"}
+
+// TablePrinter prints hits as aligned columns fitting the terminal width.
+// Rows are kept until flushed so every column can be sized after its widest value.
+type TablePrinter struct {
+	writer io.Writer
+	width  int
+	fields []string
+	rows   [][]string
+}
+
+// NewTablePrinter creates a printer laying out the given fields within width characters.
+func NewTablePrinter(fields []string, width int, writer io.Writer) *TablePrinter {
+	if len(fields) <= 0 {
+		fields = DefaultTableFields
+	}
+	return &TablePrinter{
+		writer: writer,
+		width:  width,
+		fields: fields,
+	}
+}
+
+// Print keeps the hit as a row to be printed once flushed.
+func (p *TablePrinter) Print(hit map[string]interface{}) error {
+	source, _ := hit[sourceKey].(map[string]interface{})
+	flat := Flatten(source)
+	row := make([]string, len(p.fields))
+	for i, field := range p.fields {
+		row[i] = singleLine(Format(Lookup(hit, flat, field)))
+	}
+	p.rows = append(p.rows, row)
+	return nil
+}
+
+// Flush prints the header and every row kept so far.
+func (p *TablePrinter) Flush() error {
+	if len(p.rows) <= 0 {
+		return nil
+	}
+	widths := p.columnWidths()
+	lines := append([][]string{p.fields}, p.rows...)
+	for _, line := range lines {
+		cells := make([]string, len(line))
+		for i, cell := range line {
+			cells[i] = fit(cell, widths[i], i == len(line)-1)
+		}
+		_, err := fmt.Fprintln(p.writer, strings.Join(cells, columnGap))
+		if err != nil {
+			return err
+		}
+	}
+	p.rows = nil
+	return nil
+}
+
+// columnWidths sizes each column after its widest value, then narrows the widest columns until the table fits.
+func (p *TablePrinter) columnWidths() []int {
+	widths := make([]int, len(p.fields))
+	for i, field := range p.fields {
+		widths[i] = utf8.RuneCountInString(field)
+	}
+	for _, row := range p.rows {
+		for i, cell := range row {
+			if width := utf8.RuneCountInString(cell); width > widths[i] {
+				widths[i] = width
+			}
+		}
+	}
+	total := utf8.RuneCountInString(columnGap) * (len(widths) - 1)
+	for _, width := range widths {
+		total += width
+	}
+	for total > p.width {
+		widest := 0
+		for i, width := range widths {
+			if width > widths[widest] {
+				widest = i
+			}
+		}
+		if widths[widest] <= minColumnWidth {
+			break
+		}
+		widths[widest]--
+		total--
+	}
+	return widths
+}
+
+// fit truncates the value with an ellipsis when it does not fit the width. Values are padded to the width
+// unless they belong to the last column.
+func fit(value string, width int, last bool) string {
+	if utf8.RuneCountInString(value) > width {
+		value = strings.TrimRight(string([]rune(value)[:width-1]), " ") + ellipsis
+	}
+	length := utf8.RuneCountInString(value)
+	if last {
+		return value
+	}
+	return value + strings.Repeat(" ", width-length)
+}
+
+func singleLine(value string) string {
+	return strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ", "\t", " ").Replace(value)
+}
@@ -0,0 +1,39 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTableWithDefaultFields(t *testing.T) {
+	var out bytes.Buffer
+	printer := NewTablePrinter(nil, 80, &out)
+	_ = printer.Print(hitFrom(t, `{"_source":{"@timestamp":"2021-01-01T00:00:00Z","message":"disk\nfull"}}`))
+	_ = printer.Print(hitFrom(t, `{"_source":{"@timestamp":"2021-01-01T00:00:01Z"}}`))
+	if out.Len() > 0 {
+		t.Fatal("Table must only be printed once flushed")
+	}
+	if err := printer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	expected := "@timestamp            message\n" +
+		"2021-01-01T00:00:00Z  disk full\n" +
+		"2021-01-01T00:00:01Z  \n"
+	if out.String() != expected {
+		t.Fatalf("Expected table to be %q but was %q", expected, out.String())
+	}
+}
+
+func TestTableTruncatesToWidth(t *testing.T) {
+	var out bytes.Buffer
+	printer := NewTablePrinter([]string{"host", "message"}, 20, &out)
+	_ = printer.Print(hitFrom(t, `{"_source":{"host":"web-1","message":"a very long message that does not fit"}}`))
+	if err := printer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	expected := "host   message\n" +
+		"web-1  a very long…\n"
+	if out.String() != expected {
+		t.Fatalf("Expected table to be %q but was %q", expected, out.String())
+	}
+}
@@ -0,0 +1,179 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+var (
+	actionPattern = regexp.MustCompile(`(?s){{.*?}}`)
+	// fieldPattern matches field chains like ._source.@timestamp, which are not valid template identifiers.
+	fieldPattern    = regexp.MustCompile(`(^|[\s(|{-])\.([^\s()|."{}]+(?:\.[^\s()|."{}]+)*)`)
+	identifierChars = regexp.MustCompile(`^[\pL_][\pL\pN_]*$`)
+	dateLayouts     = []string{time.RFC3339Nano, "2006-01-02T15:04:05.000Z0700", "2006-01-02 15:04:05", "2006-01-02"}
+)
+
+// TemplatePrinter renders each hit with a Go text/template, followed by a line break.
+// Field chains which are not valid identifiers, e.g. ._source.@timestamp, are looked up with the field function.
+type TemplatePrinter struct {
+	writer   io.Writer
+	template *template.Template
+}
+
+// NewTemplatePrinter parses the template used to render hits.
+func NewTemplatePrinter(text string, writer io.Writer) (*TemplatePrinter, error) {
+	hitTemplate, err := template.New("hit").Funcs(templateFuncs).Parse(rewriteFields(text))
+	if err != nil {
+		return nil, err
+	}
+	return &TemplatePrinter{
+		writer:   writer,
+		template: hitTemplate,
+	}, nil
+}
+
+// Print renders the hit.
+func (p *TemplatePrinter) Print(hit map[string]interface{}) error {
+	var out bytes.Buffer
+	err := p.template.Execute(&out, hit)
+	if err != nil {
+		return err
+	}
+	if !bytes.HasSuffix(out.Bytes(), []byte("\n")) {
+		out.WriteByte('\n')
+	}
+	_, err = p.writer.Write(out.Bytes())
+	return err
+}
+
+// Flush does nothing as every hit is printed right away.
+func (p *TemplatePrinter) Flush() error {
+	return nil
+}
+
+// rewriteFields replaces field chains holding invalid identifiers by calls to the field function,
+// e.g. {{._source.@timestamp}} becomes {{(field . "_source.@timestamp")}}.
+func rewriteFields(text string) string {
+	return actionPattern.ReplaceAllStringFunc(text, func(action string) string {
+		return fieldPattern.ReplaceAllStringFunc(action, func(chain string) string {
+			groups := fieldPattern.FindStringSubmatch(chain)
+			for _, name := range strings.Split(groups[2], ".") {
+				if !identifierChars.MatchString(name) {
+					return fmt.Sprintf(`%s(field . %q)`, groups[1], groups[2])
+				}
+			}
+			return chain
+		})
+	})
+}
+
+var templateFuncs = template.FuncMap{
+	"field":   field,
+	"json":    toJSON,
+	"date":    formatDate,
+	"default": defaultValue,
+	"pad":     pad,
+	"padLeft": padLeft,
+}
+
+// field looks up a dotted path, e.g. field . "_source.geo.city". Keys holding dots are matched as well.
+func field(data interface{}, path string) interface{} {
+	return lookupPath(data, strings.Split(path, "."))
+}
+
+func lookupPath(data interface{}, names []string) interface{} {
+	if len(names) <= 0 {
+		return data
+	}
+	object, ok := data.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	for i := len(names); i > 0; i-- {
+		if value, ok := object[strings.Join(names[:i], ".")]; ok {
+			return lookupPath(value, names[i:])
+		}
+	}
+	return nil
+}
+
+func toJSON(value interface{}) (string, error) {
+	asJSON, err := json.Marshal(value)
+	return string(asJSON), err
+}
+
+// formatDate formats dates given as text or as epoch millis using a Go time layout, in the local time zone.
+func formatDate(layout string, value interface{}) (string, error) {
+	var date time.Time
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case json.Number:
+		millis, err := v.Int64()
+		if err != nil {
+			return "", err
+		}
+		date = time.Unix(0, millis*int64(time.Millisecond))
+	case float64:
+		date = time.Unix(0, int64(v)*int64(time.Millisecond))
+	case string:
+		if millis, err := strconv.ParseInt(v, 10, 64); err == nil {
+			date = time.Unix(0, millis*int64(time.Millisecond))
+			break
+		}
+		parsed, err := parseDate(v)
+		if err != nil {
+			return "", err
+		}
+		date = parsed
+	default:
+		return "", fmt.Errorf("unable to format %v as a date", value)
+	}
+	return date.Local().Format(layout), nil
+}
+
+func parseDate(value string) (time.Time, error) {
+	var err error
+	for _, layout := range dateLayouts {
+		var date time.Time
+		date, err = time.Parse(layout, value)
+		if err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// defaultValue gives the value, or the default one when the value is missing or empty.
+// E.g. {{._source.user | default "anonymous"}}.
+func defaultValue(defaultTo interface{}, value interface{}) interface{} {
+	if value == nil {
+		return defaultTo
+	}
+	reflected := reflect.ValueOf(value)
+	switch reflected.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		if reflected.Len() <= 0 {
+			return defaultTo
+		}
+	}
+	return value
+}
+
+// pad fills the value with spaces on the right up to width characters.
+func pad(width int, value interface{}) string {
+	return fmt.Sprintf("%-*s", width, Format(value))
+}
+
+// padLeft fills the value with spaces on the left up to width characters.
+func padLeft(width int, value interface{}) string {
+	return fmt.Sprintf("%*s", width, Format(value))
+}
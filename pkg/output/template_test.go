@@ -0,0 +1,52 @@
+package output
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTemplateWithFieldChains(t *testing.T) {
+	var out bytes.Buffer
+	printer, err := NewTemplatePrinter(`{{._source.@timestamp}} {{._source.message}} {{._id}}`, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = printer.Print(hitFrom(t, `{"_id":"1","_source":{"@timestamp":"2021-01-01T00:00:00Z","message":"disk full"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "2021-01-01T00:00:00Z disk full 1\n"
+	if out.String() != expected {
+		t.Fatalf("Expected template output to be %q but was %q", expected, out.String())
+	}
+}
+
+func TestTemplateHelpers(t *testing.T) {
+	var out bytes.Buffer
+	text := `{{date "2006-01-02" ._source.@timestamp}}|{{pad 6 ._source.level}}|{{padLeft 5 ._source.code}}|` +
+		`{{._source.user | default "anonymous"}}|{{json ._source.geo}}|{{field . "_source.host.name"}}`
+	printer, err := NewTemplatePrinter(text, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	millis := time.Date(2021, 3, 4, 12, 0, 0, 0, time.Local).UnixNano() / int64(time.Millisecond)
+	hit := hitFrom(t, `{"_source":{"@timestamp":`+strconv.FormatInt(millis, 10)+`,"level":"WARN","code":42,"user":"",`+
+		`"geo":{"city":"Porto"},"host.name":"web-1"}}`)
+	err = printer.Print(hit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `2021-03-04|WARN  |   42|anonymous|{"city":"Porto"}|web-1` + "\n"
+	if out.String() != expected {
+		t.Fatalf("Expected template output to be %q but was %q", expected, out.String())
+	}
+}
+
+func TestInvalidTemplate(t *testing.T) {
+	_, err := NewTemplatePrinter(`{{._source.message`, &bytes.Buffer{})
+	if err == nil {
+		t.Fatal("Parsing an invalid template must fail")
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !linux && !freebsd && !darwin && !dragonfly && !netbsd && !openbsd
+// +build !linux,!freebsd,!darwin,!dragonfly,!netbsd,!openbsd
+
+package output
+
+import (
+	"io"
+	"os"
+	"strconv"
+)
+
+// TerminalWidth guesses how many columns the terminal has. The COLUMNS environment variable takes precedence,
+// and it falls back to 80 columns otherwise.
+func TerminalWidth(writer io.Writer) int {
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+	return defaultTerminalWidth
+}
@@ -0,0 +1,34 @@
+//go:build linux || freebsd || darwin || dragonfly || netbsd || openbsd
+// +build linux freebsd darwin dragonfly netbsd openbsd
+
+package output
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+// TerminalWidth guesses how many columns the terminal behind the writer has. The COLUMNS environment variable
+// takes precedence, and it falls back to 80 columns when the writer is not a terminal.
+func TerminalWidth(writer io.Writer) int {
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+	if file, ok := writer.(*os.File); ok {
+		var dimensions [4]uint16
+		_, _, errno := syscall.Syscall6(
+			syscall.SYS_IOCTL,
+			file.Fd(),
+			uintptr(syscall.TIOCGWINSZ),
+			uintptr(unsafe.Pointer(&dimensions)),
+			0, 0, 0,
+		)
+		if errno == 0 && dimensions[1] > 0 {
+			return int(dimensions[1])
+		}
+	}
+	return defaultTerminalWidth
+}
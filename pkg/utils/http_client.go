@@ -1,24 +1,50 @@
 package utils
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"sync"
 	"time"
 )
 
 // A DefaultHTTPClient represents properties to be used during a HTTP call.
 type DefaultHTTPClient struct {
 	Timeout time.Duration
+	TLS     TLSSettings
+	client  *http.Client
+	// tlsClients caches the clients given by WithTLS, so the files are read and the connections pooled once per
+	// settings.
+	tlsClients map[TLSSettings]*DefaultHTTPClient
+	lock       sync.Mutex
+}
+
+// TLSSettings represents the TLS properties of a server: a CA bundle to trust besides the system ones, a client
+// certificate and key for mutual TLS, and whether certificate verification is skipped altogether.
+type TLSSettings struct {
+	CAFile             string
+	ClientCert         string
+	ClientKey          string
+	InsecureSkipVerify bool
 }
 
 // A HTTPClient represents a contract to make http requests.
 type HTTPClient interface {
 	Call(req *http.Request) (*http.Response, error)
 	NewRequest(method, url string, body io.Reader) (*http.Request, error)
+	// WithTLS gives a client placing requests with the TLS settings. The client is left as is when there is none.
+	WithTLS(settings TLSSettings) (HTTPClient, error)
 }
 
 // Call places the actual the http request.
 func (c *DefaultHTTPClient) Call(req *http.Request) (*http.Response, error) {
+	if c.client != nil {
+		return c.client.Do(req)
+	}
 	client := http.Client{
 		Timeout: c.Timeout,
 	}
@@ -29,3 +55,73 @@ func (c *DefaultHTTPClient) Call(req *http.Request) (*http.Response, error) {
 func (c *DefaultHTTPClient) NewRequest(method, url string, body io.Reader) (*http.Request, error) {
     return http.NewRequest(method, url, body)
 }
+
+// WithTLS gives a copy of the client whose connections are set up with the TLS settings. The copy is built once per
+// settings and reused afterwards.
+func (c *DefaultHTTPClient) WithTLS(settings TLSSettings) (HTTPClient, error) {
+	if settings.IsEmpty() {
+		return c, nil
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if client, ok := c.tlsClients[settings]; ok {
+		return client, nil
+	}
+	tlsConfig, err := settings.Config()
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	client := &DefaultHTTPClient{
+		Timeout: c.Timeout,
+		TLS:     settings,
+		client: &http.Client{
+			Timeout:   c.Timeout,
+			Transport: transport,
+		},
+	}
+	if c.tlsClients == nil {
+		c.tlsClients = map[TLSSettings]*DefaultHTTPClient{}
+	}
+	c.tlsClients[settings] = client
+	return client, nil
+}
+
+// IsEmpty tells whether no TLS setting is given, so the defaults apply.
+func (s TLSSettings) IsEmpty() bool {
+	return s == TLSSettings{}
+}
+
+// Config builds the tls.Config out of the settings. The CA bundle is added to the system certificate pool, and the
+// client certificate and key must be given together.
+func (s TLSSettings) Config() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: s.InsecureSkipVerify,
+	}
+	if len(s.CAFile) > 0 {
+		pem, err := ioutil.ReadFile(s.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in CA file '%s'", s.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if len(s.ClientCert) > 0 || len(s.ClientKey) > 0 {
+		if len(s.ClientCert) <= 0 || len(s.ClientKey) <= 0 {
+			return nil, errors.New("client certificate and client key must be given together")
+		}
+		certificate, err := tls.LoadX509KeyPair(s.ClientCert, s.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTLSServer(clientAuth tls.ClientAuthType) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = &tls.Config{ClientAuth: clientAuth}
+	server.StartTLS()
+	return server
+}
+
+// writePEM writes the certificate and key the test server presents, so they can be given as CA bundle and client
+// certificate alike.
+func writePEM(t *testing.T, server *httptest.Server) (string, string, func()) {
+	dir, err := ioutil.TempDir("", "kishell-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate := server.TLS.Certificates[0]
+	key, err := x509.MarshalPKCS8PrivateKey(certificate.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Certificate[0]})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key})
+	if err := ioutil.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile, func() { os.RemoveAll(dir) }
+}
+
+func get(t *testing.T, client HTTPClient, url string) error {
+	request, err := client.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := client.Call(request)
+	if err != nil {
+		return err
+	}
+	return response.Body.Close()
+}
+
+func TestUnknownAuthorityIsRejected(t *testing.T) {
+	server := newTLSServer(tls.NoClientCert)
+	defer server.Close()
+
+	client := &DefaultHTTPClient{Timeout: 5 * time.Second}
+	if err := get(t, client, server.URL); err == nil {
+		t.Fatal("Server certificate must not be trusted without the CA file")
+	}
+}
+
+func TestCAFile(t *testing.T) {
+	server := newTLSServer(tls.NoClientCert)
+	defer server.Close()
+	certFile, _, cleanup := writePEM(t, server)
+	defer cleanup()
+
+	client, err := (&DefaultHTTPClient{Timeout: 5 * time.Second}).WithTLS(TLSSettings{CAFile: certFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := get(t, client, server.URL); err != nil {
+		t.Fatal("Server certificate must be trusted through the CA file", err)
+	}
+}
+
+func TestInsecureSkipVerify(t *testing.T) {
+	server := newTLSServer(tls.NoClientCert)
+	defer server.Close()
+
+	client, err := (&DefaultHTTPClient{Timeout: 5 * time.Second}).WithTLS(TLSSettings{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := get(t, client, server.URL); err != nil {
+		t.Fatal("Server certificate must not be verified", err)
+	}
+}
+
+func TestClientCertificate(t *testing.T) {
+	server := newTLSServer(tls.RequireAnyClientCert)
+	defer server.Close()
+	certFile, keyFile, cleanup := writePEM(t, server)
+	defer cleanup()
+
+	withoutCert, err := (&DefaultHTTPClient{Timeout: 5 * time.Second}).WithTLS(TLSSettings{CAFile: certFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := get(t, withoutCert, server.URL); err == nil {
+		t.Fatal("Server must require a client certificate")
+	}
+
+	withCert, err := (&DefaultHTTPClient{Timeout: 5 * time.Second}).WithTLS(TLSSettings{
+		CAFile:     certFile,
+		ClientCert: certFile,
+		ClientKey:  keyFile,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := get(t, withCert, server.URL); err != nil {
+		t.Fatal("Client certificate must be presented", err)
+	}
+}
+
+func TestInvalidTLSSettings(t *testing.T) {
+	tests := []TLSSettings{
+		{CAFile: "missing-ca.pem"},
+		{ClientCert: "cert.pem"},
+		{ClientKey: "key.pem"},
+	}
+	for _, settings := range tests {
+		if _, err := settings.Config(); err == nil {
+			t.Errorf("Expected TLS settings %+v to be invalid", settings)
+		}
+	}
+}
+
+func TestEmptyTLSSettingsKeepClient(t *testing.T) {
+	client := &DefaultHTTPClient{Timeout: 5 * time.Second}
+	withTLS, err := client.WithTLS(TLSSettings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if withTLS != client {
+		t.Error("Client must be left as is without TLS settings")
+	}
+}
+
+func TestTLSClientReused(t *testing.T) {
+	server := newTLSServer(tls.NoClientCert)
+	defer server.Close()
+	certFile, _, cleanup := writePEM(t, server)
+	defer cleanup()
+
+	client := &DefaultHTTPClient{Timeout: 5 * time.Second}
+	first, err := client.WithTLS(TLSSettings{CAFile: certFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := client.WithTLS(TLSSettings{CAFile: certFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Error("Client must be built once per TLS settings")
+	}
+	other, err := client.WithTLS(TLSSettings{CAFile: certFile, InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == first {
+		t.Error("Clients must not be shared across different TLS settings")
+	}
+}